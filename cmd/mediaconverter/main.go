@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+
+	"github.com/abates/mediacleaner/internal/cli"
+)
+
+// mediaconverter is an alias for "mediacleaner convert"
+func main() {
+	os.Exit(cli.Alias("convert", os.Args))
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+
+	"github.com/abates/mediacleaner/internal/cli"
+)
+
+// mediaevents is an alias for "mediacleaner events"
+func main() {
+	os.Exit(cli.Alias("events", os.Args))
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+
+	"github.com/abates/mediacleaner/internal/cli"
+)
+
+// mediashift is an alias for "mediacleaner shift"
+func main() {
+	os.Exit(cli.Alias("shift", os.Args))
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+
+	"github.com/abates/mediacleaner/internal/cli"
+)
+
+// mediathumbs is an alias for "mediacleaner thumbs"
+func main() {
+	os.Exit(cli.Alias("thumbs", os.Args))
+}
@@ -0,0 +1,372 @@
+package mediacleaner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/abates/goexiftool"
+)
+
+var (
+	// ErrNoMetadata indicates that exiftool returned nothing for a file,
+	// usually because the file could not be read
+	ErrNoMetadata = errors.New("exiftool returned no metadata")
+
+	// ErrNotWritten indicates that exiftool didn't update a file
+	ErrNotWritten = errors.New("exiftool did not update the file")
+
+	// ExifToolBatchSize is the maximum number of files read by a single
+	// exiftool command.  Only reads requested at the same time are batched,
+	// so batches are no bigger than the number of jobs run concurrently
+	ExifToolBatchSize = 64
+
+	exifTool = &ExifTool{}
+)
+
+type exifRequest struct {
+	ctx      context.Context
+	filename string
+	args     []string
+	info     map[string]string
+	err      error
+	done     chan struct{}
+}
+
+// ExifTool reads metadata using a long running exiftool process started with
+// "-stay_open True -@ -".  Reads that are requested while the process is busy
+// are batched into a single command.  Files aren't read ahead of their jobs,
+// so with one job at a time (a Concurrency of 1) every read is a command of
+// its own, but exiftool still isn't started again for each file.  If exiftool
+// exits unexpectedly it is restarted on the next read.  If a read's context
+// is done while exiftool is working on it, exiftool is killed and the rest of
+// the batch is retried.  The command is taken from goexiftool.ExifTool when
+// it is set, so that the same exiftool is used for reading and writing
+type ExifTool struct {
+	mu      sync.Mutex
+	pending []*exifRequest
+	busy    bool
+
+	// cmdMu guards the exiftool process, only the
+	// goroutine executing a batch uses the process
+	cmdMu  sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	seq    int
+}
+
+// ReadExif reads the file's metadata using the shared exiftool process
+func ReadExif(filename string) (*goexiftool.MediaFile, error) {
+	return exifTool.Read(filename)
+}
+
+// ReadExifContext is ReadExif with a context that limits how long the
+// read may take
+func ReadExifContext(ctx context.Context, filename string) (*goexiftool.MediaFile, error) {
+	return exifTool.ReadContext(ctx, filename)
+}
+
+// WriteExifContext changes the file's metadata using the shared exiftool
+// process.  args are the exiftool options, such as "-AllDates=..."
+func WriteExifContext(ctx context.Context, filename string, args ...string) error {
+	return exifTool.WriteContext(ctx, filename, args...)
+}
+
+// CloseExifTool stops the shared exiftool process.  It is started
+// again if any more metadata is read
+func CloseExifTool() error {
+	return exifTool.Close()
+}
+
+// Read the file's metadata.  The returned MediaFile is the same as one
+// created by goexiftool.NewMediaFile
+func (et *ExifTool) Read(filename string) (*goexiftool.MediaFile, error) {
+	return et.ReadContext(context.Background(), filename)
+}
+
+// ReadContext reads the file's metadata, giving up once the context is done
+func (et *ExifTool) ReadContext(ctx context.Context, filename string) (*goexiftool.MediaFile, error) {
+	req := &exifRequest{ctx: ctx, filename: filename, done: make(chan struct{})}
+	if err := et.do(req); err != nil {
+		return nil, err
+	}
+	return &goexiftool.MediaFile{Filename: filename, Info: req.info}, nil
+}
+
+// WriteContext changes the file's metadata.  Writes are never batched
+// with other requests since exiftool applies the options to every file
+// in a command.  exiftool is killed if the context is done first
+func (et *ExifTool) WriteContext(ctx context.Context, filename string, args ...string) error {
+	return et.do(&exifRequest{ctx: ctx, filename: filename, args: args, done: make(chan struct{})})
+}
+
+// do queues the request and waits for it to be answered
+func (et *ExifTool) do(req *exifRequest) error {
+	et.mu.Lock()
+	et.pending = append(et.pending, req)
+	leader := !et.busy
+	et.busy = true
+	et.mu.Unlock()
+
+	// the first caller executes batches until there is nothing left to do,
+	// anyone arriving in the meantime waits for their request to be answered
+	if leader {
+		for {
+			et.mu.Lock()
+			batch := nextBatch(et.pending)
+			et.pending = et.pending[len(batch):]
+			if len(batch) == 0 {
+				et.busy = false
+				et.mu.Unlock()
+				break
+			}
+			et.mu.Unlock()
+			et.execute(batch)
+		}
+	}
+
+	select {
+	case <-req.done:
+	case <-req.ctx.Done():
+		return req.ctx.Err()
+	}
+	return req.err
+}
+
+// nextBatch returns the requests, from the start of pending, that can be
+// sent to exiftool as a single command
+func nextBatch(pending []*exifRequest) []*exifRequest {
+	if len(pending) > 0 && len(pending[0].args) > 0 {
+		return pending[0:1]
+	}
+
+	n := 0
+	for n < len(pending) && len(pending[n].args) == 0 && (n < ExifToolBatchSize || ExifToolBatchSize <= 0) {
+		n++
+	}
+	return pending[0:n]
+}
+
+func (et *ExifTool) start() error {
+	name, args := "exiftool", []string{}
+	if goexiftool.ExifTool != nil {
+		name, args = goexiftool.ExifTool.Args[0], goexiftool.ExifTool.Args[1:]
+	} else if _, err := exec.LookPath(name); err != nil {
+		return errors.New("exiftool is not installed")
+	}
+
+	cmd := exec.Command(name, append(args, "-stay_open", "True", "-@", "-")...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err == nil {
+		et.cmd, et.stdin, et.stdout = cmd, stdin, bufio.NewReader(stdout)
+	}
+	return err
+}
+
+// stop closes exiftool's input, asking it to exit, and waits for it
+func (et *ExifTool) stop(kill bool) error {
+	if et.cmd == nil {
+		return nil
+	}
+
+	if kill {
+		et.cmd.Process.Kill()
+	} else {
+		fmt.Fprint(et.stdin, "-stay_open\nFalse\n")
+	}
+	et.stdin.Close()
+	err := et.cmd.Wait()
+	et.cmd, et.stdin, et.stdout = nil, nil, nil
+	if kill {
+		err = nil
+	}
+	return err
+}
+
+// Close stops the exiftool process
+func (et *ExifTool) Close() error {
+	et.cmdMu.Lock()
+	defer et.cmdMu.Unlock()
+	return et.stop(false)
+}
+
+// execute reads the batch, restarting exiftool and trying
+// again if it exits part way through
+func (et *ExifTool) execute(batch []*exifRequest) {
+	et.cmdMu.Lock()
+	defer et.cmdMu.Unlock()
+
+	var output []string
+	err := errors.New("exiftool not started")
+	for attempt := 0; attempt < 2 && err != nil; attempt++ {
+		if batch = cancelled(batch); len(batch) == 0 {
+			return
+		}
+
+		if et.cmd == nil {
+			if err = et.start(); err != nil {
+				continue
+			}
+		}
+
+		stop := et.watch(batch)
+		output, err = et.send(batch)
+		if stop() {
+			// the batch was interrupted, try again without the cancelled reads
+			attempt--
+			et.stop(true)
+		} else if err != nil {
+			Errorf("exiftool exited unexpectedly, restarting: %v", err)
+			et.stop(true)
+		}
+	}
+
+	infos := parseExifOutput(batch, output)
+	for _, req := range batch {
+		if err != nil {
+			req.err = err
+		} else if len(req.args) > 0 {
+			req.err = writeResult(req.filename, output)
+		} else if req.info = infos[req.filename]; len(req.info) == 0 {
+			req.err = fmt.Errorf("%w for %q", ErrNoMetadata, req.filename)
+		}
+		close(req.done)
+	}
+}
+
+// cancelled answers the requests whose context is done and returns the rest
+func cancelled(batch []*exifRequest) []*exifRequest {
+	remaining := []*exifRequest{}
+	for _, req := range batch {
+		if err := req.ctx.Err(); err != nil {
+			req.err = err
+			close(req.done)
+		} else {
+			remaining = append(remaining, req)
+		}
+	}
+	return remaining
+}
+
+// watch kills exiftool if any of the requests' contexts are done before the
+// returned stop function is called.  stop reports whether exiftool was killed
+func (et *ExifTool) watch(batch []*exifRequest) (stop func() bool) {
+	done := make(chan struct{})
+	killed := make(chan struct{})
+	once := sync.Once{}
+	proc := et.cmd.Process
+	for _, req := range batch {
+		if req.ctx.Done() == nil {
+			continue
+		}
+
+		go func(ctx context.Context) {
+			select {
+			case <-ctx.Done():
+				once.Do(func() {
+					proc.Kill()
+					close(killed)
+				})
+			case <-done:
+			}
+		}(req.ctx)
+	}
+
+	return func() bool {
+		close(done)
+		once.Do(func() {})
+		select {
+		case <-killed:
+			return true
+		default:
+		}
+		return false
+	}
+}
+
+// send writes the batch to exiftool and reads the output up to the
+// ready message
+func (et *ExifTool) send(batch []*exifRequest) ([]string, error) {
+	et.seq++
+	args := &strings.Builder{}
+	for _, req := range batch {
+		for _, arg := range req.args {
+			fmt.Fprintf(args, "%s\n", arg)
+		}
+		fmt.Fprintf(args, "%s\n", req.filename)
+	}
+	fmt.Fprintf(args, "-execute%d\n", et.seq)
+	if _, err := io.WriteString(et.stdin, args.String()); err != nil {
+		return nil, err
+	}
+
+	ready := fmt.Sprintf("{ready%d}", et.seq)
+	output := []string{}
+	for {
+		line, err := et.stdout.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == ready {
+			return output, nil
+		} else if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		output = append(output, line)
+	}
+}
+
+// writeResult checks exiftool's summary of a write, such as
+// "1 image files updated"
+func writeResult(filename string, output []string) error {
+	for _, line := range output {
+		line = strings.TrimSpace(line)
+		if (strings.HasSuffix(line, "files updated") || strings.HasSuffix(line, "files unchanged")) && !strings.HasPrefix(line, "0 ") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %q: %s", ErrNotWritten, filename, strings.TrimSpace(strings.Join(output, "; ")))
+}
+
+// parseExifOutput splits exiftool's output into the tags for each file.  When
+// more than one file is read exiftool starts each file's output with a
+// "======== filename" header
+func parseExifOutput(batch []*exifRequest, output []string) map[string]map[string]string {
+	infos := make(map[string]map[string]string)
+	var info map[string]string
+	if len(batch) == 1 {
+		info = make(map[string]string)
+		infos[batch[0].filename] = info
+	}
+
+	for _, line := range output {
+		if strings.HasPrefix(line, "======== ") {
+			info = make(map[string]string)
+			infos[strings.TrimPrefix(line, "======== ")] = info
+			continue
+		}
+
+		res := strings.SplitN(line, ":", 2)
+		if info != nil && len(res) > 1 {
+			info[strings.TrimSpace(res[0])] = strings.TrimSpace(res[1])
+		}
+	}
+	return infos
+}
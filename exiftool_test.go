@@ -0,0 +1,188 @@
+package mediacleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abates/mediacleaner/internal/exiftooltest"
+)
+
+func fakeExiftool() func() {
+	return exiftooltest.Mock(CloseExifTool)
+}
+
+func TestFakeExifTool(t *testing.T) {
+	exiftooltest.Run()
+}
+
+func TestExifToolRead(t *testing.T) {
+	defer fakeExiftool()()
+	tempdir, _ := ioutil.TempDir("", "exiftool_test")
+	defer os.RemoveAll(tempdir)
+
+	files := map[string]string{
+		"image.jpg": "File Type : JPEG\nDate/Time Original : 2019:07:14 10:00:00\n",
+		"crash.jpg": "File Type : crash\n",
+	}
+	for filename, content := range files {
+		ioutil.WriteFile(filepath.Join(tempdir, filename), []byte(content), 0640)
+	}
+
+	pid := ""
+	tests := []struct {
+		filename    string
+		wantType    string
+		wantErr     error
+		wantRestart bool
+	}{
+		{"image.jpg", "JPEG", nil, false},
+		{"image.jpg", "JPEG", nil, false},
+		{"missing.jpg", "", ErrNoMetadata, false},
+		{"crash.jpg", "crash", nil, true},
+		{"image.jpg", "JPEG", nil, false},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d %s", i, test.filename), func(t *testing.T) {
+			mf, err := ReadExif(filepath.Join(tempdir, test.filename))
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			} else if err != nil {
+				return
+			}
+
+			if got, _ := mf.Get("File Type"); test.wantType != got {
+				t.Errorf("Wanted File Type %q got %q", test.wantType, got)
+			}
+
+			gotPid, _ := mf.Get("Pid")
+			if pid != "" && test.wantRestart == (pid == gotPid) {
+				t.Errorf("Wanted restart %v, exiftool pid was %s and is now %s", test.wantRestart, pid, gotPid)
+			}
+			pid = gotPid
+		})
+	}
+}
+
+func TestExifToolBatch(t *testing.T) {
+	defer fakeExiftool()()
+	tempdir, _ := ioutil.TempDir("", "exiftool_test")
+	defer os.RemoveAll(tempdir)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		filename := filepath.Join(tempdir, fmt.Sprintf("%02d.jpg", i))
+		ioutil.WriteFile(filename, []byte(fmt.Sprintf("Image Number : %d\n", i)), 0640)
+		wg.Add(1)
+		go func(i int, filename string) {
+			defer wg.Done()
+			mf, err := ReadExif(filename)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if got, _ := mf.Get("Image Number"); got != fmt.Sprint(i) {
+				t.Errorf("Wanted image number %d got %q", i, got)
+			}
+		}(i, filename)
+	}
+	wg.Wait()
+}
+
+func TestExifToolTimeout(t *testing.T) {
+	defer fakeExiftool()()
+	tempdir, _ := ioutil.TempDir("", "exiftool_test")
+	defer os.RemoveAll(tempdir)
+	ioutil.WriteFile(filepath.Join(tempdir, "hang.jpg"), []byte("File Type : hang\n"), 0640)
+	ioutil.WriteFile(filepath.Join(tempdir, "image.jpg"), []byte("File Type : JPEG\n"), 0640)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := ReadExifContext(ctx, filepath.Join(tempdir, "hang.jpg"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wanted %v got %v", context.DeadlineExceeded, err)
+	}
+
+	// exiftool must have been killed and restarted for the next read
+	mf, err := ReadExif(filepath.Join(tempdir, "image.jpg"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := mf.Get("File Type"); got != "JPEG" {
+		t.Errorf("Wanted File Type %q got %q", "JPEG", got)
+	}
+}
+
+func TestExifToolWrite(t *testing.T) {
+	defer fakeExiftool()()
+	tempdir, _ := ioutil.TempDir("", "exiftool_test")
+	defer os.RemoveAll(tempdir)
+	ioutil.WriteFile(filepath.Join(tempdir, "image.jpg"), []byte("File Type : JPEG\n"), 0640)
+
+	tests := []struct {
+		filename string
+		wantErr  error
+	}{
+		{"image.jpg", nil},
+		{"missing.jpg", ErrNotWritten},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			filename := filepath.Join(tempdir, test.filename)
+			err := WriteExifContext(context.Background(), filename, "-Title=Vacation")
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			} else if err != nil {
+				return
+			}
+
+			mf, err := ReadExif(filename)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got, _ := mf.Get("Title"); got != "Vacation" {
+				t.Errorf("Wanted Title %q got %q", "Vacation", got)
+			}
+		})
+	}
+}
+
+func TestNextBatch(t *testing.T) {
+	read := &exifRequest{}
+	write := &exifRequest{args: []string{"-Title=x"}}
+	tests := []struct {
+		name    string
+		pending []*exifRequest
+		want    int
+	}{
+		{"reads", []*exifRequest{read, read, read}, 3},
+		{"reads before a write", []*exifRequest{read, read, write, read}, 2},
+		{"write", []*exifRequest{write, write, read}, 1},
+		{"empty", nil, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := len(nextBatch(test.pending)); test.want != got {
+				t.Errorf("Wanted %d requests got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseExifOutput(t *testing.T) {
+	batch := []*exifRequest{{filename: "/a.jpg"}, {filename: "/b: c.jpg"}}
+	output := []string{"======== /a.jpg", "File Type : JPEG", "======== /b: c.jpg", "File Type : PNG", "Title : a: b", "    2 image files read"}
+	got := parseExifOutput(batch, output)
+	if got["/a.jpg"]["File Type"] != "JPEG" || got["/b: c.jpg"]["File Type"] != "PNG" || got["/b: c.jpg"]["Title"] != "a: b" || len(got["/b: c.jpg"]) != 2 {
+		t.Errorf("Unexpected output %v", got)
+	}
+}
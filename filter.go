@@ -0,0 +1,177 @@
+package mediacleaner
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mh-orange/vfs"
+)
+
+// IgnoreFile is the name of the file, at the top of a root, that lists
+// glob patterns of files and directories to exclude, one per line.  It is
+// read when processing of the root starts
+const IgnoreFile = ".mediacleanerignore"
+
+var (
+	// DefaultExcludes are the files and directories that are never
+	// processed: NAS thumbnail and trash directories, the convert
+	// command's trash, the duplicates found by dups, the copies exiftool
+	// keeps when metadata is written and the ignore file itself.  Commands
+	// add the files they keep their own records in
+	DefaultExcludes = []string{"@eaDir", ".thumbnails", ".Trash-*", ".trash", "*_dups", "*_original", IgnoreFile}
+
+	// IncludeFlag limits processing to the files matching one of the
+	// patterns, when it is not empty
+	IncludeFlag globList
+
+	// ExcludeFlag lists patterns of files and directories that are
+	// not processed, in addition to DefaultExcludes
+	ExcludeFlag globList
+)
+
+// globList is a flag.Value holding a comma separated list of glob patterns.
+// Patterns without a slash match the name of a file or of any directory
+// above it, so "@eaDir" excludes everything in every @eaDir directory.
+// Patterns with a slash match the path from the root, "/2019/tmp" excludes
+// that one directory
+type globList []string
+
+func (gl *globList) String() string {
+	return strings.Join(*gl, ",")
+}
+
+func (gl *globList) Set(str string) error {
+	for _, pattern := range strings.Split(str, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+		*gl = append(*gl, pattern)
+	}
+	return nil
+}
+
+// match reports whether the pattern matches the filename or any of the
+// directories above it.  The filename is relative to the root
+func match(pattern, filename string) bool {
+	elements := strings.Split(strings.TrimPrefix(path.Clean("/"+filename), "/"), "/")
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+		for i := range elements {
+			if ok, _ := path.Match(pattern, path.Join(elements[:i+1]...)); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, element := range elements {
+		if ok, _ := path.Match(pattern, element); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filter decides which of a root's files are processed
+type filter struct {
+	includes []string
+	excludes []string
+}
+
+// newFilter creates the filter for the root from the default excludes,
+// the -include and -exclude flags and the root's ignore file
+func newFilter(fs vfs.FileSystem) *filter {
+	f := &filter{
+		includes: IncludeFlag,
+		excludes: append(append([]string{}, DefaultExcludes...), ExcludeFlag...),
+	}
+
+	if _, err := fs.Stat("/" + IgnoreFile); vfs.IsNotExist(err) {
+		return f
+	}
+
+	data, err := vfs.ReadFile(fs, "/"+IgnoreFile)
+	if err != nil {
+		Errorf("Failed to read %s: %v", IgnoreFile, err)
+		return f
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSuffix(line, "/")
+		if _, err := path.Match(line, ""); err != nil {
+			Errorf("Ignoring pattern %q in %s: %v", line, IgnoreFile, err)
+			continue
+		}
+		f.excludes = append(f.excludes, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		Errorf("Failed to read %s: %v", IgnoreFile, err)
+	}
+	return f
+}
+
+// Excluder returns a function reporting whether a file, or directory, of
+// the root is excluded by the default excludes, the -include and -exclude
+// flags or the root's ignore file.  It is for commands that walk the root
+// themselves
+func Excluder(fs vfs.FileSystem) func(filename string, isDir bool) bool {
+	return newFilter(fs).excluded
+}
+
+// excluded reports whether the file, or directory, is not to be processed.
+// The root itself is never excluded and include patterns only apply to
+// files
+func (f *filter) excluded(filename string, isDir bool) bool {
+	if path.Clean("/"+filename) == "/" {
+		return false
+	}
+
+	for _, pattern := range f.excludes {
+		if match(pattern, filename) {
+			return true
+		}
+	}
+
+	if isDir || len(f.includes) == 0 {
+		return false
+	}
+
+	for _, pattern := range f.includes {
+		if match(pattern, filename) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchDirs watches the directory and the directories below it, except
+// for those that are excluded
+func (f *filter) watchDirs(fs vfs.FileSystem, dir string, watcher vfs.Watcher) {
+	vfs.Walk(fs, dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		} else if f.excluded(filename, true) {
+			return vfs.ErrSkipDir
+		}
+
+		if err := watcher.Watch(filename); err != nil {
+			Errorf("Failed to watch %q: %v", filename, err)
+		}
+		return nil
+	})
+}
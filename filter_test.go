@@ -0,0 +1,114 @@
+package mediacleaner
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+)
+
+func TestGlobList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    globList
+		wantErr bool
+	}{
+		{"*.tmp", globList{"*.tmp"}, false},
+		{"*.tmp, *.part,", globList{"*.tmp", "*.part"}, false},
+		{"[", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got := globList{}
+			err := got.Set(test.input)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if !test.wantErr && !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFilterExcluded(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+	vfs.WriteFile(fs, "/"+IgnoreFile, []byte("# comments are ignored\n\nprivate/\n/2019/tmp\n[\n"), 0640)
+
+	oldInclude, oldExclude := IncludeFlag, ExcludeFlag
+	defer func() { IncludeFlag, ExcludeFlag = oldInclude, oldExclude }()
+	IncludeFlag = globList{"*.jpg", "/2020"}
+	ExcludeFlag = globList{"*.tmp.jpg"}
+	f := newFilter(fs)
+
+	tests := []struct {
+		filename string
+		isDir    bool
+		want     bool
+	}{
+		{"/", true, false},
+		{"/2019/01/a.jpg", false, false},
+		{"/2019/01/a.mov", false, true},
+		{"/2020/01/a.mov", false, false},
+		{"/2019/01", true, false},
+		{"/@eaDir", true, true},
+		{"/2019/01/@eaDir/a.jpg/SYNOFILE_THUMB_M.jpg", false, true},
+		{"/.thumbnails/normal/a.jpg", false, true},
+		{"/.Trash-1000/files/a.jpg", false, true},
+		{"/.trash/2019/01/a.heic", false, true},
+		{"/2019/01/a.jpg_dups/a.jpg", false, true},
+		{"/2019/01/a.jpg_original", false, true},
+		{"/" + IgnoreFile, false, true},
+		{"/2019/01/a.tmp.jpg", false, true},
+		{"/private/a.jpg", false, true},
+		{"/2019/tmp", true, true},
+		{"/2019/tmp/a.jpg", false, true},
+		{"/2018/tmp/a.jpg", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			got := f.excluded(test.filename, test.isDir)
+			if test.want != got {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestWalkExcluded(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+	for _, filename := range []string{"/a.jpg", "/@eaDir/a.jpg/thumb.jpg", "/2019/.Trash-1000/b.jpg", "/2019/b.jpg"} {
+		vfs.MkdirAll(fs, path.Dir(filename), 0755)
+		vfs.WriteFile(fs, filename, []byte{}, 0640)
+	}
+
+	got := []string{}
+	walkFn := walk(fs, "", nil, func(fs vfs.FileSystem, filename string, root string) ContextJob {
+		got = append(got, filename)
+		return nil
+	})
+	visited := 0
+	vfs.Walk(fs, "/", func(filename string, info os.FileInfo, err error) error {
+		visited++
+		return walkFn(filename, info, err)
+	})
+
+	sort.Strings(got)
+	want := []string{"/2019/b.jpg", "/a.jpg"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	// /, /2019, /2019/.Trash-1000, /2019/b.jpg, /@eaDir and /a.jpg
+	if visited != 6 {
+		t.Errorf("Wanted excluded directories to be skipped, visited %d files", visited)
+	}
+}
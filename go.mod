@@ -7,7 +7,6 @@ require (
 	github.com/mattn/go-colorable v0.1.2 // indirect
 	github.com/mattn/go-runewidth v0.0.4 // indirect
 	github.com/mh-orange/cmd v0.0.0-20190814014331-b4f5d21a036d
-	github.com/mh-orange/ffmpeg v0.0.0-20191101143614-56bfe8c58b8e
 	github.com/mh-orange/vfs v0.0.0-20190802160435-3c572b2c1ee3
 	github.com/mitchellh/gox v1.0.1 // indirect
 	golang.org/x/net v0.0.0-20191028085509-fe3aa8a45271 // indirect
@@ -0,0 +1,401 @@
+// Package cli implements the mediacleaner command and its subcommands.  The
+// original binaries, such as mediarenamer, are aliases for a subcommand
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/abates/mediacleaner/internal/convert"
+	"github.com/abates/mediacleaner/internal/dups"
+	"github.com/abates/mediacleaner/internal/events"
+	"github.com/abates/mediacleaner/internal/rename"
+	"github.com/abates/mediacleaner/internal/shift"
+	"github.com/abates/mediacleaner/internal/thumbs"
+	"github.com/abates/mediacleaner/internal/transcode"
+)
+
+var (
+	errNoStages = errors.New("no stages given")
+
+	// stages are the jobs that can be chained into a pipeline
+	stages = map[string]mediacleaner.ContextFileCallback{
+		"rename":    rename.NewJob,
+		"transcode": transcode.NewJob,
+		"thumbs":    thumbs.NewJob,
+	}
+
+	// photosAndVideos are the media types handled by most commands
+	photosAndVideos = []mediacleaner.MediaType{mediacleaner.Image, mediacleaner.Video}
+
+	stagesFlag = "rename,transcode,thumbs"
+	configFlag = configFile()
+)
+
+// command is a mediacleaner subcommand
+type command struct {
+	summary string
+
+	// flags registers the command's options
+	flags func(flags *flag.FlagSet)
+
+	// checkTimeout and executeTimeout are the command's default timeouts
+	checkTimeout   time.Duration
+	executeTimeout time.Duration
+
+	// types are the media types the command processes by default
+	types []mediacleaner.MediaType
+
+	// run processes the roots and returns the exit code
+	run func(roots []string) int
+
+	// standalone commands don't use mediacleaner.Flags and the scan/watch
+	// options that go with it
+	standalone bool
+}
+
+var commands = map[string]*command{
+	"rename": {
+		summary:      "rename files into /YYYY/MM directories by the date they were taken",
+		flags:        rename.RegisterFlags,
+		checkTimeout: time.Minute,
+		types:        photosAndVideos,
+		run:          jobRunner(rename.NewJob),
+	},
+	"transcode": {
+		summary: "transcode videos to h264/mp4",
+		flags:   transcode.RegisterFlags,
+		// transcodes can take hours, so only the checks time out
+		checkTimeout: time.Minute,
+		types:        []mediacleaner.MediaType{mediacleaner.Video},
+		run:          jobRunner(transcode.NewJob),
+	},
+	"thumbs": {
+		summary:        "create thumbnails for images and videos",
+		flags:          thumbs.RegisterFlags,
+		checkTimeout:   time.Minute,
+		executeTimeout: thumbs.ExecuteTimeout,
+		types:          photosAndVideos,
+		run:            jobRunner(thumbs.NewJob),
+	},
+	"convert": {
+		summary:        "convert HEIC and raw images to jpeg",
+		flags:          convert.RegisterFlags,
+		checkTimeout:   time.Minute,
+		executeTimeout: 5 * time.Minute,
+		types:          []mediacleaner.MediaType{mediacleaner.Image},
+		run:            jobRunner(convert.NewJob),
+	},
+	"shift": {
+		summary:      "shift the dates of files taken by a camera with the wrong clock",
+		flags:        shift.RegisterFlags,
+		checkTimeout: time.Minute,
+		types:        photosAndVideos,
+		run:          shift.Run,
+	},
+	"events": {
+		summary: "move renamed files into event directories",
+		flags:   events.RegisterFlags,
+		types:   photosAndVideos,
+		run:     events.Run,
+	},
+	"undo": {
+		summary: "move files in event directories back to where they were moved from",
+		flags:   events.RegisterFlags,
+		types:   photosAndVideos,
+		run:     undo,
+	},
+	"watch": {
+		summary:      "watch the directories and run the -stages pipeline on new files",
+		flags:        pipelineFlags,
+		checkTimeout: time.Minute,
+		types:        photosAndVideos,
+		run:          watch,
+	},
+	"report": {
+		summary:      "report what the -stages pipeline would do without changing anything",
+		flags:        pipelineFlags,
+		checkTimeout: time.Minute,
+		types:        photosAndVideos,
+		run:          runReport,
+	},
+	"dups": {
+		summary:    "find files with the same content",
+		flags:      dups.RegisterFlags,
+		run:        findDups,
+		standalone: true,
+	},
+}
+
+func jobRunner(cb mediacleaner.ContextFileCallback) func([]string) int {
+	return func(roots []string) int {
+		p := mediacleaner.Start(roots, cb)
+		p.Wait()
+		return p.ExitCode()
+	}
+}
+
+func undo(roots []string) int {
+	mediacleaner.Flags.Set("undo", "true")
+	return events.Run(roots)
+}
+
+func pipelineFlags(flags *flag.FlagSet) {
+	flags.StringVar(&stagesFlag, "stages", stagesFlag, fmt.Sprintf("stages - comma separated list of the stages run on each file, in order (%s)", strings.Join(stageNames(), ", ")))
+	rename.RegisterFlags(flags)
+	transcode.RegisterFlags(flags)
+	thumbs.RegisterFlags(flags)
+}
+
+func watch(roots []string) int {
+	chain, err := parseStages(stagesFlag)
+	if err != nil {
+		mediacleaner.Errorf("%v", err)
+		return 1
+	}
+
+	mediacleaner.WatchFlag = true
+	return jobRunner(mediacleaner.Pipeline(chain...))(roots)
+}
+
+func runReport(roots []string) int {
+	chain, err := parseStages(stagesFlag)
+	if err != nil {
+		mediacleaner.Errorf("%v", err)
+		return 1
+	}
+
+	if mediacleaner.WatchFlag {
+		mediacleaner.Errorf("report can't be used with -w")
+		return 1
+	}
+
+	mediacleaner.ScanFlag = true
+	r := newReport(stageList(stagesFlag), chain)
+	p := mediacleaner.Start(roots, r.callback)
+	p.Wait()
+	r.print(os.Stdout)
+	return p.ExitCode()
+}
+
+func findDups(roots []string) int {
+	for _, root := range roots {
+		if err := dups.Run(root); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func stageNames() []string {
+	names := []string{}
+	for name := range stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stageList splits a comma separated list of stages
+func stageList(str string) []string {
+	names := []string{}
+	for _, name := range strings.Split(str, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseStages parses a comma separated list of stages, such
+// as rename,transcode,thumbs
+func parseStages(str string) ([]mediacleaner.ContextFileCallback, error) {
+	chain := []mediacleaner.ContextFileCallback{}
+	for _, name := range stageList(str) {
+		stage, found := stages[name]
+		if !found {
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+		chain = append(chain, stage)
+	}
+
+	if len(chain) == 0 {
+		return nil, errNoStages
+	}
+	return chain, nil
+}
+
+// pipeline is the command for a comma separated list of stages given in
+// place of a subcommand, such as "mediacleaner rename,thumbs"
+func pipeline(chain []mediacleaner.ContextFileCallback) *command {
+	return &command{
+		flags:        pipelineFlags,
+		checkTimeout: time.Minute,
+		types:        photosAndVideos,
+		run:          jobRunner(mediacleaner.Pipeline(chain...)),
+	}
+}
+
+func usage(prog string) {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [options] <dir1> <dir2> ...\n\nCommands:\n", prog)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nA comma separated list of stages (%s) runs them in order on each file.\n", strings.Join(stageNames(), ", "))
+	fmt.Fprintf(os.Stderr, "Run \"%s <command> -h\" for the command's options\n", prog)
+}
+
+// knownOptions returns the names of every command's options, used to find
+// mistakes in the config file
+func knownOptions() map[string]bool {
+	known := map[string]bool{"config": true}
+	add := func(f *flag.Flag) { known[f.Name] = true }
+	mediacleaner.Flags.VisitAll(add)
+	for _, cmd := range commands {
+		flags := flag.NewFlagSet("", flag.ContinueOnError)
+		cmd.flags(flags)
+		flags.VisitAll(add)
+	}
+	return known
+}
+
+// Main runs the mediacleaner command with the given arguments and returns
+// the exit code
+func Main(args []string) int {
+	prog := filepath.Base(args[0])
+	if len(args) < 2 {
+		usage(prog)
+		return 1
+	}
+
+	name := args[1]
+	cmd, found := commands[name]
+	if !found {
+		switch name {
+		case "-h", "-help", "--help", "help":
+			usage(prog)
+			return 0
+		}
+
+		chain, err := parseStages(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+			usage(prog)
+			return 1
+		}
+		cmd = pipeline(chain)
+	}
+	return run(name, cmd, prog+" "+name, []string{name}, args[2:])
+}
+
+// Alias runs one of mediacleaner's commands under the name of the binary
+// that used to implement it, mediarenamer runs rename for instance
+func Alias(name string, args []string) int {
+	return run(name, commands[name], filepath.Base(args[0]), nil, args[1:])
+}
+
+// run runs the command.  selector holds the arguments that chose the
+// command, they are needed to run the command again for groups of roots
+func run(name string, cmd *command, prog string, selector []string, args []string) int {
+	// the config is checked before the command's options are registered,
+	// registering them again for knownOptions would reset their values
+	known := knownOptions()
+
+	flags := mediacleaner.Flags
+	if cmd.standalone {
+		flags = flag.NewFlagSet(prog, flag.ExitOnError)
+		flags.Usage = dups.Usage(flags, prog)
+	} else {
+		flags.Usage = func() {
+			fmt.Fprintf(flags.Output(), "Usage: %s [options] <dir1> <dir2> ...\n\nOptions:\n", prog)
+			flags.PrintDefaults()
+		}
+		mediacleaner.SetTimeouts(cmd.checkTimeout, cmd.executeTimeout)
+		mediacleaner.SetTypes(cmd.types...)
+	}
+	flags.StringVar(&configFlag, "config", configFlag, "config - file holding default options, per command and per directory")
+	cmd.flags(flags)
+	flags.Parse(args)
+	if cmd.standalone && flags.NArg() < 1 {
+		flags.Usage()
+		return 1
+	}
+
+	cfg, err := loadConfig(configFlag)
+	if err == nil {
+		err = cfg.validate(known)
+	}
+
+	groups := [][]string{}
+	if err == nil {
+		groups, err = cfg.rootGroups(flags.Args())
+	}
+
+	section := name
+	if err == nil {
+		// the section for a list of stages is [pipeline]
+		if _, found := commands[name]; !found {
+			section = "pipeline"
+		}
+
+		if len(groups) > 1 {
+			// the per root settings are applied by the processes
+			// started for each group
+			err = cfg.apply(flags, section, nil)
+		} else {
+			err = cfg.apply(flags, section, flags.Args())
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 2
+	}
+
+	if len(groups) > 1 {
+		options := args[:len(args)-flags.NArg()]
+		return runGroups(append(append([]string{}, selector...), options...), groups, name == "watch" || mediacleaner.WatchFlag)
+	}
+
+	if runsRename(name) {
+		rename.ExcludeUnsorted()
+	}
+	return cmd.run(flags.Args())
+}
+
+// runsRename determines if the command renames files, either as the rename
+// command or as one of the stages
+func runsRename(name string) bool {
+	stages := name
+	switch name {
+	case "rename":
+		return true
+	case "watch", "report":
+		stages = stagesFlag
+	default:
+		if _, found := commands[name]; found {
+			return false
+		}
+	}
+
+	for _, stage := range stageList(stages) {
+		if stage == "rename" {
+			return true
+		}
+	}
+	return false
+}
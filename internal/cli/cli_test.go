@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestParseStages(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"rename", 1, false},
+		{"rename,transcode,thumbs", 3, false},
+		{"rename, thumbs", 2, false},
+		{"rename,index", 0, true},
+		{"", 0, true},
+		{",", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := parseStages(test.input)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if test.want != len(got) {
+				t.Errorf("Wanted %d stages got %d", test.want, len(got))
+			}
+		})
+	}
+}
+
+func TestRunsRename(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages string
+		want   bool
+	}{
+		{"rename", "", true},
+		{"thumbs", "rename,thumbs", false},
+		{"watch", "rename,thumbs", true},
+		{"watch", "transcode,thumbs", false},
+		{"report", "rename", true},
+		{"rename,thumbs", "", true},
+		{"transcode,thumbs", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+" "+test.stages, func(t *testing.T) {
+			oldStages := stagesFlag
+			stagesFlag = test.stages
+			defer func() { stagesFlag = oldStages }()
+
+			if got := runsRename(test.name); test.want != got {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables that override
+// options, MEDIACLEANER_SETTLE=10s sets -settle for instance
+const envPrefix = "MEDIACLEANER_"
+
+// config holds the options read from the config file by section.  Options
+// before the first section apply to every command, [command] sections apply
+// to one command and [/path] sections apply when processing that root.  Each
+// line is "option = value" where option is a command line flag name
+//
+//	settle = 10s
+//
+//	[rename]
+//	fallback-mtime = true
+//
+//	[/srv/photos]
+//	device = dir
+type config map[string]map[string]string
+
+// configFile returns the default location of the config file,
+// $XDG_CONFIG_HOME/mediacleaner/config
+func configFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mediacleaner", "config")
+}
+
+// parseConfig reads a config file.  Blank lines and lines beginning with
+// # are ignored
+func parseConfig(reader io.Reader) (config, error) {
+	cfg := config{"": {}}
+	section := ""
+	scanner := bufio.NewScanner(reader)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if strings.HasPrefix(section, "/") {
+				section = filepath.Clean(section)
+			}
+
+			if section == "" {
+				return nil, fmt.Errorf("line %d: empty section name", i)
+			} else if cfg[section] == nil {
+				cfg[section] = make(map[string]string)
+			}
+			continue
+		}
+
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[0]) == "" {
+			return nil, fmt.Errorf("line %d: expected \"option = value\"", i)
+		}
+		cfg[section][strings.TrimSpace(fields[0])] = strings.TrimSpace(fields[1])
+	}
+	return cfg, scanner.Err()
+}
+
+// loadConfig reads the config file, a missing file is an empty config
+func loadConfig(filename string) (config, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return config{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cfg, err := parseConfig(file)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", filename, err)
+	}
+	return cfg, err
+}
+
+// validate makes sure every option in the config is known
+func (cfg config) validate(known map[string]bool) error {
+	for _, section := range cfg.sections() {
+		for name := range cfg[section] {
+			if known[name] {
+				continue
+			} else if section == "" {
+				return fmt.Errorf("unknown option %q", name)
+			}
+			return fmt.Errorf("unknown option %q in section [%s]", name, section)
+		}
+	}
+	return nil
+}
+
+func (cfg config) sections() []string {
+	sections := []string{}
+	for section := range cfg {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// rootSettings returns the settings of the roots.  The roots always share
+// their settings, those with different settings are processed in separate
+// processes, see rootGroups
+func (cfg config) rootSettings(roots []string) (map[string]string, error) {
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	abs, err := filepath.Abs(roots[0])
+	if err != nil {
+		return nil, err
+	}
+	return cfg[abs], nil
+}
+
+// rootGroups groups the roots that have the same settings, keeping the
+// order they were given in
+func (cfg config) rootGroups(roots []string) ([][]string, error) {
+	groups := [][]string{}
+	index := make(map[string]int)
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprint(cfg[abs])
+		if i, found := index[key]; found {
+			groups[i] = append(groups[i], root)
+		} else {
+			index[key] = len(groups)
+			groups = append(groups, []string{root})
+		}
+	}
+	return groups, nil
+}
+
+// envName returns the environment variable that overrides the option
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// apply sets the options that weren't given on the command line.  Options
+// from the command's section override global ones, per root settings
+// override those and environment variables take precedence over the file
+func (cfg config) apply(flags *flag.FlagSet, command string, roots []string) error {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	rs, err := cfg.rootSettings(roots)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string)
+	for _, settings := range []map[string]string{cfg[""], cfg[command], rs} {
+		for name, value := range settings {
+			values[name] = value
+		}
+	}
+
+	flags.VisitAll(func(f *flag.Flag) {
+		if value, found := os.LookupEnv(envName(f.Name)); found {
+			values[f.Name] = value
+		}
+	})
+
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if set[name] || flags.Lookup(name) == nil {
+			continue
+		}
+
+		if err := flags.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid value %q for option %s: %v", values[name], name, err)
+		}
+	}
+	return nil
+}
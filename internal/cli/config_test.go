@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    config
+		wantErr bool
+	}{
+		{"empty", "", config{"": {}}, false},
+		{"global", "settle = 10s\n# comment\n\nq=true", config{"": {"settle": "10s", "q": "true"}}, false},
+		{"sections", "q = true\n[rename]\nfallback-mtime = true\n[ /srv/photos/ ]\ndevice = dir", config{"": {"q": "true"}, "rename": {"fallback-mtime": "true"}, "/srv/photos": {"device": "dir"}}, false},
+		{"value with equals", "name = a=b", config{"": {"name": "a=b"}}, false},
+		{"no value", "settle", nil, true},
+		{"no option", "= 10s", nil, true},
+		{"empty section", "[]", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseConfig(strings.NewReader(test.input))
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if !test.wantErr && !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	known := map[string]bool{"settle": true, "device": true}
+	tests := []struct {
+		name    string
+		cfg     config
+		wantErr bool
+	}{
+		{"known", config{"": {"settle": "1s"}, "/srv": {"device": "dir"}}, false},
+		{"unknown global", config{"": {"setle": "1s"}}, true},
+		{"unknown in section", config{"rename": {"devise": "dir"}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.cfg.validate(known)
+			if test.wantErr != (err != nil) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	cfg := config{
+		"":          {"a": "global", "b": "global", "c": "global", "d": "global", "e": "global"},
+		"rename":    {"b": "command", "c": "command", "d": "command", "e": "command"},
+		"transcode": {"a": "other command"},
+		"/srv/a":    {"c": "root", "d": "root", "e": "root"},
+		"/srv/b":    {"c": "other root"},
+	}
+
+	tests := []struct {
+		name  string
+		roots []string
+		env   map[string]string
+		args  []string
+		want  map[string]string
+	}{
+		{"global and command", []string{"/srv/c"}, nil, nil, map[string]string{"a": "global", "b": "command", "c": "command", "d": "command", "e": "command", "extra-opt": ""}},
+		{"root", []string{"/srv/a"}, nil, nil, map[string]string{"a": "global", "b": "command", "c": "root", "d": "root", "e": "root", "extra-opt": ""}},
+		{"env", []string{"/srv/a/"}, map[string]string{"MEDIACLEANER_D": "env", "MEDIACLEANER_EXTRA_OPT": "env"}, nil, map[string]string{"a": "global", "b": "command", "c": "root", "d": "env", "e": "root", "extra-opt": "env"}},
+		{"command line", []string{"/srv/a"}, map[string]string{"MEDIACLEANER_D": "env"}, []string{"-d", "args", "-e", "args"}, map[string]string{"a": "global", "b": "command", "c": "root", "d": "args", "e": "args", "extra-opt": ""}},
+		{"same settings", []string{"/srv/c", "/srv/d"}, nil, nil, map[string]string{"a": "global", "b": "command", "c": "command", "d": "command", "e": "command", "extra-opt": ""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				os.Setenv(name, value)
+				defer os.Unsetenv(name)
+			}
+
+			flags := flag.NewFlagSet("", flag.ContinueOnError)
+			got := make(map[string]*string)
+			for _, name := range []string{"a", "b", "c", "d", "e", "extra-opt"} {
+				got[name] = flags.String(name, "", "")
+			}
+			flags.Parse(test.args)
+
+			err := cfg.apply(flags, "rename", test.roots)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for name, want := range test.want {
+				if *got[name] != want {
+					t.Errorf("Wanted %s to be %q got %q", name, want, *got[name])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	flags := flag.NewFlagSet("", flag.ContinueOnError)
+	flags.Bool("q", false, "")
+	cfg := config{"": {"q": "maybe"}}
+	if err := cfg.apply(flags, "rename", []string{"/srv"}); err == nil {
+		t.Errorf("Wanted an error for an invalid value")
+	}
+}
+
+func TestRootGroups(t *testing.T) {
+	cfg := config{
+		"/srv/a": {"device": "dir"},
+		"/srv/b": {"device": "filename"},
+		"/srv/c": {"device": "dir"},
+	}
+
+	tests := []struct {
+		name  string
+		roots []string
+		want  [][]string
+	}{
+		{"no settings", []string{"/srv/d", "/srv/e"}, [][]string{{"/srv/d", "/srv/e"}}},
+		{"same settings", []string{"/srv/a", "/srv/c/"}, [][]string{{"/srv/a", "/srv/c/"}}},
+		{"different settings", []string{"/srv/a", "/srv/b", "/srv/c", "/srv/d"}, [][]string{{"/srv/a", "/srv/c"}, {"/srv/b"}, {"/srv/d"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := cfg.rootGroups(test.roots)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
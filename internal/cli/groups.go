@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/abates/mediacleaner"
+)
+
+// startGroup starts mediacleaner again with the given arguments, it is
+// replaced in tests
+var startGroup = func(args []string) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	c := exec.Command(exe, args...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	detach(c)
+	return c, c.Start()
+}
+
+// runGroups processes each group of roots in its own process so that
+// the group's settings can be applied, options are held in global flags.
+// The groups are processed one after another unless they are watched,
+// watching doesn't end so every group is started at once.  Signals are
+// passed on to the processes, groups that haven't started once a signal
+// is received are skipped, and the highest exit code is returned
+func runGroups(options []string, groups [][]string, concurrent bool) int {
+	mu := sync.Mutex{}
+	running := []*exec.Cmd{}
+	stopped := false
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer close(signals)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			mu.Lock()
+			stopped = true
+			for _, c := range running {
+				c.Process.Signal(sig)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	exitCode := 0
+	exit := func(code int) {
+		mu.Lock()
+		if code > exitCode {
+			exitCode = code
+		}
+		mu.Unlock()
+	}
+
+	wg := sync.WaitGroup{}
+	for _, roots := range groups {
+		mu.Lock()
+		stop := stopped
+		mu.Unlock()
+		if stop {
+			exit(mediacleaner.ExitIncomplete)
+			break
+		}
+
+		c, err := startGroup(append(append([]string{}, options...), roots...))
+		if err != nil {
+			mediacleaner.Errorf("Failed to process %v: %v", roots, err)
+			exit(1)
+			continue
+		}
+
+		mu.Lock()
+		running = append(running, c)
+		mu.Unlock()
+
+		wg.Add(1)
+		wait := func(c *exec.Cmd) {
+			c.Wait()
+			if code := c.ProcessState.ExitCode(); code < 0 {
+				// killed by a signal
+				exit(mediacleaner.ExitIncomplete)
+			} else {
+				exit(code)
+			}
+			wg.Done()
+		}
+
+		if concurrent {
+			go wait(c)
+		} else {
+			wait(c)
+		}
+	}
+	wg.Wait()
+	return exitCode
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestGroupProcess is run by the processes started by runGroups in tests,
+// it exits with the code given by its last argument
+func TestGroupProcess(t *testing.T) {
+	if os.Getenv("MEDIACLEANER_TEST_GROUP") == "" {
+		return
+	}
+
+	code, _ := strconv.Atoi(strings.TrimPrefix(os.Args[len(os.Args)-1], "/exit"))
+	os.Exit(code)
+}
+
+func TestRunGroups(t *testing.T) {
+	oldStart := startGroup
+	defer func() { startGroup = oldStart }()
+
+	tests := []struct {
+		name       string
+		groups     [][]string
+		concurrent bool
+		want       int
+	}{
+		{"success", [][]string{{"/exit0", "/exit0"}, {"/exit0"}}, false, 0},
+		{"highest exit code", [][]string{{"/exit3"}, {"/exit1"}, {"/exit0"}}, false, 3},
+		{"concurrent", [][]string{{"/exit1"}, {"/exit2"}}, true, 2},
+		{"start failed", [][]string{{"/exit0"}, {"/fail"}}, false, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			started := [][]string{}
+			startGroup = func(args []string) (*exec.Cmd, error) {
+				mu.Lock()
+				started = append(started, args)
+				mu.Unlock()
+				if args[len(args)-1] == "/fail" {
+					return nil, errors.New("failed to start")
+				}
+
+				c := exec.Command(os.Args[0], append([]string{"-test.run=TestGroupProcess", "--"}, args...)...)
+				c.Env = append(os.Environ(), "MEDIACLEANER_TEST_GROUP=1")
+				return c, c.Start()
+			}
+
+			got := runGroups([]string{"rename", "-device", "dir"}, test.groups, test.concurrent)
+			if test.want != got {
+				t.Errorf("Wanted exit code %d got %d", test.want, got)
+			}
+
+			want := [][]string{}
+			for _, roots := range test.groups {
+				want = append(want, append([]string{"rename", "-device", "dir"}, roots...))
+			}
+
+			if !test.concurrent && !reflect.DeepEqual(want, started) {
+				t.Errorf("Wanted %v got %v", want, started)
+			} else if len(want) != len(started) {
+				t.Errorf("Wanted %d processes got %d", len(want), len(started))
+			}
+		})
+	}
+}
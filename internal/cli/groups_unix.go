@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach puts the process in its own process group so that signals sent
+// to the terminal's process group are only passed on once, by runGroups
+func detach(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+// +build windows
+
+package cli
+
+import "os/exec"
+
+func detach(c *exec.Cmd) {}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+const wouldProcess = "would be processed"
+
+// report counts, for every stage, the files that would be processed and
+// the reasons the others would be skipped.  Only the stages' checks are
+// run and each stage is checked against the file as it is now, so a file
+// that an earlier stage would move is reported under its current name
+type report struct {
+	mu     sync.Mutex
+	names  []string
+	stages []mediacleaner.ContextFileCallback
+	counts []map[string]int
+}
+
+func newReport(names []string, stages []mediacleaner.ContextFileCallback) *report {
+	r := &report{names: names, stages: stages}
+	for range stages {
+		r.counts = append(r.counts, make(map[string]int))
+	}
+	return r
+}
+
+func (r *report) add(stage int, reason string) {
+	r.mu.Lock()
+	r.counts[stage][reason]++
+	r.mu.Unlock()
+}
+
+func (r *report) callback(fs vfs.FileSystem, filename string, root string) mediacleaner.ContextJob {
+	return &reportJob{report: r, fs: fs, filename: filename, root: root}
+}
+
+// print writes the counts for each stage, most common first
+func (r *report) print(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, name := range r.names {
+		reasons := []string{}
+		for reason := range r.counts[i] {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(j, k int) bool {
+			cj, ck := r.counts[i][reasons[j]], r.counts[i][reasons[k]]
+			if cj == ck {
+				return reasons[j] < reasons[k]
+			}
+			return cj > ck
+		})
+
+		fmt.Fprintf(w, "%s:\n", name)
+		for _, reason := range reasons {
+			fmt.Fprintf(w, "  %6d %s\n", r.counts[i][reason], reason)
+		}
+	}
+}
+
+// reason describes the result of a stage's check
+func reason(err error) string {
+	ce := &mediacleaner.CheckError{}
+	if err == nil {
+		return wouldProcess
+	} else if errors.As(err, &ce) {
+		if ce.Cause == nil {
+			return ce.Error()
+		}
+		return "skipped: " + ce.Cause.Error()
+	}
+	return "failed: " + err.Error()
+}
+
+type reportJob struct {
+	report   *report
+	fs       vfs.FileSystem
+	filename string
+	root     string
+}
+
+func (rj *reportJob) Name() string { return rj.filename }
+
+func (rj *reportJob) Check(ctx context.Context) error {
+	for i, stage := range rj.report.stages {
+		if job := stage(rj.fs, rj.filename, rj.root); job != nil {
+			rj.report.add(i, reason(job.Check(ctx)))
+		}
+	}
+	return nil
+}
+
+// Execute does nothing, the report only runs the checks
+func (rj *reportJob) Execute(ctx context.Context) error { return nil }
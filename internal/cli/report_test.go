@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+type checkJob struct {
+	filename string
+	err      error
+}
+
+func (cj *checkJob) Name() string                      { return cj.filename }
+func (cj *checkJob) Check(ctx context.Context) error   { return cj.err }
+func (cj *checkJob) Execute(ctx context.Context) error { panic("report executed a job") }
+
+func stage(errs map[string]error) mediacleaner.ContextFileCallback {
+	return func(fs vfs.FileSystem, filename string, root string) mediacleaner.ContextJob {
+		err, found := errs[filename]
+		if !found {
+			return nil
+		}
+		return &checkJob{filename: filename, err: err}
+	}
+}
+
+func TestReport(t *testing.T) {
+	skipped := &mediacleaner.CheckError{Cause: errors.New("already processed")}
+	r := newReport([]string{"first", "second"}, []mediacleaner.ContextFileCallback{
+		stage(map[string]error{"/a": nil, "/b": skipped, "/c": skipped}),
+		stage(map[string]error{"/a": errors.New("exiftool failed"), "/b": nil}),
+	})
+
+	for _, filename := range []string{"/a", "/b", "/c"} {
+		mediacleaner.RunJob(context.Background(), r.callback(nil, filename, "/"))
+	}
+
+	want := "first:\n" +
+		"       2 skipped: already processed\n" +
+		"       1 would be processed\n" +
+		"second:\n" +
+		"       1 failed: exiftool failed\n" +
+		"       1 would be processed\n"
+	got := &bytes.Buffer{}
+	r.print(got)
+	if want != got.String() {
+		t.Errorf("Wanted report\n%s\ngot\n%s", want, got.String())
+	}
+}
@@ -0,0 +1,164 @@
+// Package convert converts HEIC/HEIF and RAW images to JPEGs
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+var (
+	errNoFile         = errors.New("File removed prior to processing")
+	errNotRenamed     = errors.New("will only convert files that have been named correctly (/YYYY/MM/YYYY_MM_DD_HH:MM:SS_xxxx.ext)")
+	errNotConvertible = errors.New("file is not a HEIC/HEIF or RAW image")
+	errExists         = errors.New("converted file already exists")
+	errNoPreview      = errors.New("RAW file has no embedded JPEG preview")
+
+	heifExts = map[string]bool{".heic": true, ".heif": true}
+	rawExts  = map[string]bool{
+		".arw": true, ".cr2": true, ".cr3": true, ".dng": true, ".nef": true,
+		".orf": true, ".raf": true, ".rw2": true, ".pef": true, ".srw": true,
+	}
+
+	// ExifTool and HeifConvert are the external commands used to extract
+	// RAW previews, copy metadata and decode HEIC/HEIF images
+	ExifTool    = "exiftool"
+	HeifConvert = "heif-convert"
+
+	execCommand = exec.CommandContext
+
+	trashFlag    = false
+	trashDirFlag = "/.trash"
+	qualityFlag  = 90
+)
+
+// run executes the named command and returns its standard output.  The
+// command is killed if the context is done.  If the command fails, the
+// returned error includes whatever it wrote to stderr
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := execCommand(ctx, name, args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	} else if err != nil && stderr.Len() > 0 {
+		err = fmt.Errorf("%s: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	return output, err
+}
+
+type job struct {
+	fs          vfs.FileSystem
+	root        string
+	filename    string
+	newFilename string
+}
+
+func (jb *job) Name() string {
+	return jb.filename
+}
+
+func (jb *job) Check(ctx context.Context) error {
+	if fi, err := jb.fs.Stat(jb.filename); vfs.IsNotExist(err) {
+		return &mediacleaner.CheckError{Cause: errNoFile}
+	} else if err != nil {
+		return err
+	} else if fi.IsDir() {
+		return &mediacleaner.CheckError{Cause: errNotConvertible}
+	}
+
+	// only convert files that have already been named correctly
+	dir := []byte(path.Dir(jb.filename))
+	if mediacleaner.YearMonthDir.Match(dir) || mediacleaner.YearMonthDayDir.Match(dir) {
+		fn := []byte(path.Base(jb.filename))
+		if !mediacleaner.FilePrefix.Match(fn) {
+			return &mediacleaner.CheckError{Cause: errNotRenamed}
+		}
+	} else {
+		return &mediacleaner.CheckError{Cause: errNotRenamed}
+	}
+
+	ext := strings.ToLower(path.Ext(jb.filename))
+	if !heifExts[ext] && !rawExts[ext] {
+		return &mediacleaner.CheckError{Cause: errNotConvertible}
+	}
+
+	jb.newFilename = fmt.Sprintf("%s.jpg", jb.filename[0:len(jb.filename)-len(ext)])
+	if _, err := jb.fs.Stat(jb.newFilename); err == nil {
+		return &mediacleaner.CheckError{Cause: errExists}
+	}
+	return nil
+}
+
+// extractPreview writes the largest JPEG embedded in a RAW file to the output
+func (jb *job) extractPreview(ctx context.Context, input string) error {
+	for _, tag := range []string{"-JpgFromRaw", "-PreviewImage"} {
+		preview, err := run(ctx, ExifTool, "-b", tag, input)
+		if err != nil {
+			return err
+		}
+
+		if len(preview) > 0 {
+			return vfs.WriteFile(jb.fs, jb.newFilename, preview, 0640)
+		}
+	}
+	return errNoPreview
+}
+
+func (jb *job) Execute(ctx context.Context) error {
+	input := path.Join(jb.root, jb.filename)
+	output := path.Join(jb.root, jb.newFilename)
+	mediacleaner.Infof("Converting %q", jb.filename)
+
+	var err error
+	if heifExts[strings.ToLower(path.Ext(jb.filename))] {
+		_, err = run(ctx, HeifConvert, "-q", strconv.Itoa(qualityFlag), input, output)
+	} else {
+		err = jb.extractPreview(ctx, input)
+	}
+
+	if err != nil {
+		jb.fs.Remove(jb.newFilename)
+		return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to convert %q", jb.filename), Cause: err}
+	}
+
+	_, err = run(ctx, ExifTool, "-overwrite_original", "-TagsFromFile", input, "-all:all", output)
+	if err != nil {
+		return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to copy metadata to %q", jb.newFilename), Cause: err}
+	}
+
+	if trashFlag {
+		trashFilename := path.Join(trashDirFlag, jb.filename)
+		err = vfs.MkdirAll(jb.fs, path.Dir(trashFilename), 0750)
+		if err == nil {
+			err = jb.fs.Rename(jb.filename, trashFilename)
+		}
+
+		if err != nil {
+			return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to move %q to the trash", jb.filename), Cause: err}
+		}
+	}
+	return nil
+}
+
+// RegisterFlags adds the converter's options to the flag set
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&trashFlag, "trash", false, "trash - move the original file to the trash directory after converting it")
+	flags.StringVar(&trashDirFlag, "trashdir", trashDirFlag, "trashdir - directory, relative to each root, where originals are moved. Directories other than .trash should be added to -exclude so the originals aren't processed again")
+	flags.IntVar(&qualityFlag, "quality", qualityFlag, "quality - jpeg quality used when converting HEIC/HEIF images (1-100)")
+}
+
+// NewJob creates the job that converts the file
+func NewJob(fs vfs.FileSystem, filename string, root string) mediacleaner.ContextJob {
+	return &job{fs: fs, root: root, filename: filename}
+}
@@ -0,0 +1,148 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+func fakeCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cs := []string{"-test.run=TestFakeCommand", "--", name}
+	cs = append(cs, args...)
+	cmd := exec.CommandContext(ctx, os.Args[0], cs...)
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+	return cmd
+}
+
+// TestFakeCommand emulates exiftool and heif-convert.  Files
+// with "nopreview" in their name have no embedded preview
+func TestFakeCommand(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+
+	input := args[len(args)-1]
+	switch {
+	case args[0] == HeifConvert:
+		preview, _ := ioutil.ReadFile("testdata/preview.jpg")
+		ioutil.WriteFile(input, preview, 0640)
+	case args[0] == ExifTool && args[1] == "-b":
+		if !strings.Contains(input, "nopreview") {
+			preview, _ := ioutil.ReadFile("testdata/preview.jpg")
+			os.Stdout.Write(preview)
+		}
+	}
+	os.Exit(0)
+}
+
+func TestJobCheck(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+	vfs.MkdirAll(fs, "/2010/01", 0750)
+	for _, filename := range []string{"/IMG_1234.HEIC", "/2010/01/foo.heic", "/2010/01/2010_01_01_00:00:00_0001.HEIC", "/2010/01/2010_01_01_00:00:00_0002.nef", "/2010/01/2010_01_01_00:00:00_0003.png", "/2010/01/2010_01_01_00:00:00_0004.cr2", "/2010/01/2010_01_01_00:00:00_0004.jpg"} {
+		fs.Create(filename)
+	}
+
+	tests := []struct {
+		filename        string
+		wantNewFilename string
+		wantErr         error
+	}{
+		{"/2010/01/2010_01_01_00:00:00_0000.heic", "", errNoFile},
+		{"/IMG_1234.HEIC", "", errNotRenamed},
+		{"/2010/01/foo.heic", "", errNotRenamed},
+		{"/2010/01/2010_01_01_00:00:00_0001.HEIC", "/2010/01/2010_01_01_00:00:00_0001.jpg", nil},
+		{"/2010/01/2010_01_01_00:00:00_0002.nef", "/2010/01/2010_01_01_00:00:00_0002.jpg", nil},
+		{"/2010/01/2010_01_01_00:00:00_0003.png", "", errNotConvertible},
+		{"/2010/01/2010_01_01_00:00:00_0004.cr2", "", errExists},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			jb := &job{fs: fs, filename: test.filename}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr == gotErr {
+				if gotErr == nil && test.wantNewFilename != jb.newFilename {
+					t.Errorf("Wanted newFilename %q got %q", test.wantNewFilename, jb.newFilename)
+				}
+			} else {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestJobExecute(t *testing.T) {
+	execCommand = fakeCommand
+	defer func() { execCommand = exec.CommandContext }()
+	preview, _ := ioutil.ReadFile("testdata/preview.jpg")
+
+	tests := []struct {
+		filename  string
+		trash     bool
+		wantErr   error
+		wantTrash bool
+	}{
+		{"/2010/01/2010_01_01_00:00:00_0001.heic", false, nil, false},
+		{"/2010/01/2010_01_01_00:00:00_0002.nef", true, nil, true},
+		{"/2010/01/2010_01_01_00:00:00_0003_nopreview.cr2", true, errNoPreview, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			tempdir, _ := ioutil.TempDir("", "osfs_test")
+			defer os.RemoveAll(tempdir)
+			fs := vfs.NewOsFs(tempdir)
+			vfs.MkdirAll(fs, path.Dir(test.filename), 0750)
+			fs.Create(test.filename)
+
+			trashFlag = test.trash
+			defer func() { trashFlag = false }()
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			jb.newFilename = strings.TrimSuffix(test.filename, path.Ext(test.filename)) + ".jpg"
+
+			gotErr := jb.Execute(context.Background())
+			if ee, ok := gotErr.(*mediacleaner.ExecuteError); ok {
+				gotErr = ee.Cause
+			}
+
+			if test.wantErr != gotErr {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+
+			if test.wantErr == nil {
+				got, _ := vfs.ReadFile(fs, jb.newFilename)
+				if !bytes.Equal(preview, got) {
+					t.Errorf("Wanted converted file to contain the preview image")
+				}
+			} else if _, err := fs.Stat(jb.newFilename); !vfs.IsNotExist(err) {
+				t.Errorf("Wanted converted file to be removed, got %v", err)
+			}
+
+			_, err := fs.Stat(path.Join(trashDirFlag, test.filename))
+			if test.wantTrash == vfs.IsNotExist(err) {
+				t.Errorf("Wanted original in trash to be %v got %v", test.wantTrash, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package dups finds files with the same content
+package dups
+
+import (
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+var (
+	errRemoveRename = errors.New("either -remove or -rename must be specified, but not both")
+
+	images   map[[sha256.Size]byte][]string
+	excluded func(filename string, isDir bool) bool
+	root     string
+	remove   bool
+	rename   bool
+	verbose  bool
+)
+
+// RegisterFlags adds the duplicate finding options to the flag set
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&remove, "remove", false, "remove duplicate files")
+	flags.BoolVar(&rename, "rename", false, "rename duplicate files")
+	flags.BoolVar(&verbose, "verbose", false, "print verbose log")
+	flags.Var(&mediacleaner.IncludeFlag, "include", "include - comma separated glob patterns, only matching files are compared")
+	flags.Var(&mediacleaner.ExcludeFlag, "exclude", "exclude - comma separated glob patterns of files and directories that are not compared, "+mediacleaner.IgnoreFile+" at the top of a directory can list more, one per line")
+}
+
+// Usage prints the dups usage for the flag set
+func Usage(flags *flag.FlagSet, name string) func() {
+	return func() {
+		fmt.Fprintf(flags.Output(), "Usage:\n")
+		fmt.Fprintf(flags.Output(), "%s [-remove] [-rename] <path>\n", name)
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "Either -remove or -rename must be specified, but not both\n")
+	}
+}
+
+func analyze(path string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+
+	// files are skipped the same way mediacleaner's commands skip them,
+	// so copies in trash directories are never taken for the original
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	} else if excluded("/"+filepath.ToSlash(rel), info.IsDir()) {
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	} else if info.IsDir() {
+		return nil
+	}
+	log.Printf("Analyzing %q", path)
+
+	file, err := os.Open(path)
+	if err == nil {
+		digest := sha256.New()
+		_, err = io.Copy(digest, file)
+		file.Close()
+		if err == nil {
+			var hash [sha256.Size]byte
+			copy(hash[:], digest.Sum(nil))
+			if dupfiles, found := images[hash]; found {
+				log.Printf("%q is a duplicate of %q", path, dupfiles[0])
+				if rename {
+					dupdir := fmt.Sprintf("%s_dups", dupfiles[0])
+					err = os.MkdirAll(dupdir, 0750)
+					if err == nil {
+						newpath := filepath.Join(dupdir, filepath.Base(path))
+						log.Printf("Renaming %q to %q", path, newpath)
+						err = os.Rename(path, newpath)
+					}
+				} else if remove {
+					log.Printf("Removing %q", path)
+					err = os.Remove(path)
+				}
+			}
+			images[hash] = append(images[hash], path)
+		}
+	}
+
+	return err
+}
+
+// Run finds the duplicate files below the input path, renaming or removing
+// them as requested by the flags
+func Run(inputPath string) error {
+	if remove && rename {
+		return errRemoveRename
+	}
+
+	if !verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	images = make(map[[sha256.Size]byte][]string)
+	root = inputPath
+	excluded = mediacleaner.Excluder(vfs.NewOsFs(inputPath))
+	err := filepath.Walk(inputPath, analyze)
+	if err != nil {
+		return err
+	}
+
+	for _, files := range images {
+		if len(files) > 1 {
+			log.Printf("Duplicates:\n")
+			for _, file := range files {
+				log.Printf("\t%s\n", file)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package dups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		ignore      string
+		wantKept    []string
+		wantRemoved []string
+	}{
+		{"duplicate", []string{"/2019/01/a.jpg", "/2019/02/b.jpg"}, "", []string{"/2019/01/a.jpg"}, []string{"/2019/02/b.jpg"}},
+		{"trash", []string{"/.Trash-1000/files/a.jpg", "/2019/01/a.jpg"}, "", []string{"/.Trash-1000/files/a.jpg", "/2019/01/a.jpg"}, nil},
+		{"ignored", []string{"/2019/01/a.jpg", "/backup/a.jpg"}, "backup\n", []string{"/2019/01/a.jpg", "/backup/a.jpg"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir, _ := ioutil.TempDir("", "dups_test")
+			defer os.RemoveAll(tempdir)
+
+			for _, filename := range test.files {
+				filename = filepath.Join(tempdir, filename)
+				os.MkdirAll(filepath.Dir(filename), 0750)
+				ioutil.WriteFile(filename, []byte("same content"), 0640)
+			}
+
+			if test.ignore != "" {
+				ioutil.WriteFile(filepath.Join(tempdir, ".mediacleanerignore"), []byte(test.ignore), 0640)
+			}
+
+			remove = true
+			defer func() { remove = false }()
+			if err := Run(tempdir); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, filename := range test.wantKept {
+				if _, err := os.Stat(filepath.Join(tempdir, filename)); err != nil {
+					t.Errorf("Wanted %q to be kept, got %v", filename, err)
+				}
+			}
+
+			for _, filename := range test.wantRemoved {
+				if _, err := os.Stat(filepath.Join(tempdir, filename)); !os.IsNotExist(err) {
+					t.Errorf("Wanted %q to be removed, got %v", filename, err)
+				}
+			}
+		})
+	}
+}
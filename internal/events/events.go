@@ -0,0 +1,423 @@
+// Package events groups renamed files into event directories
+package events
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+// RecordFile is the name of the file, in each event directory, that
+// records the directories the files were moved from
+const RecordFile = ".mediacleanerevents"
+
+var (
+	errNoFile  = errors.New("File removed prior to processing")
+	errExists  = errors.New("destination file already exists")
+	errNoWatch = errors.New("events can only be found by scanning (-s), watching is not supported")
+
+	// EventDir matches the directories that events are moved into
+	EventDir = regexp.MustCompile(`^\/\d{4}\/\d{4}-\d{2}-\d{2} `)
+
+	gapFlag      = 24 * time.Hour
+	distanceFlag = 0.0
+	minSizeFlag  = 5
+	nameFlag     = "Event"
+	namesFlag    = eventNames{}
+	undoFlag     = false
+	dryRunFlag   = false
+)
+
+func init() {
+	// the records are never processed, by this command or any other
+	mediacleaner.DefaultExcludes = append(mediacleaner.DefaultExcludes, RecordFile)
+}
+
+// eventName names the events that start within a date range
+type eventName struct {
+	start time.Time
+	end   time.Time
+	name  string
+}
+
+// eventNames is a flag.Value that loads event names from a file.  Each line
+// of the file is "YYYY-MM-DD YYYY-MM-DD name" giving the first and last
+// days of the range.  Blank lines and lines beginning with # are ignored
+type eventNames []eventName
+
+func (en *eventNames) String() string {
+	return fmt.Sprintf("%d names", len(*en))
+}
+
+func (en *eventNames) Set(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	names := eventNames{}
+	scanner := bufio.NewScanner(file)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: expected \"YYYY-MM-DD YYYY-MM-DD name\"", filename, i)
+		}
+
+		start, err1 := time.Parse("2006-01-02", fields[0])
+		end, err2 := time.Parse("2006-01-02", fields[1])
+		name := eventDirName(fields[2])
+		if err1 != nil || err2 != nil || end.Before(start) || name == "" {
+			return fmt.Errorf("%s:%d: expected \"YYYY-MM-DD YYYY-MM-DD name\"", filename, i)
+		}
+		names = append(names, eventName{start: start, end: end.AddDate(0, 0, 1), name: name})
+	}
+	*en = names
+	return scanner.Err()
+}
+
+// lookup finds the name for an event starting at t
+func (en eventNames) lookup(t time.Time) string {
+	for _, n := range en {
+		if !t.Before(n.start) && t.Before(n.end) {
+			return n.name
+		}
+	}
+	return nameFlag
+}
+
+// eventDirName makes a name safe to use in a directory name
+func eventDirName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+}
+
+// media is a renamed file that is a candidate for grouping into an event
+type media struct {
+	filename string
+	date     time.Time
+
+	// gps is only looked up when clustering by distance
+	hasGPS   bool
+	lat, lon float64
+}
+
+// collector gathers the renamed files under each root while scanning
+type collector struct {
+	mu    sync.Mutex
+	roots []string
+	fs    map[string]vfs.FileSystem
+	files map[string][]*media
+}
+
+func newCollector() *collector {
+	return &collector{fs: make(map[string]vfs.FileSystem), files: make(map[string][]*media)}
+}
+
+// renamed determines if the file has been named by mediarenamer, and
+// whether it is in an event directory
+func renamed(filename string) (ok bool, inEvent bool) {
+	dir := []byte(path.Dir(filename))
+	if !mediacleaner.YearMonthDir.Match(dir) || !mediacleaner.FilePrefix.MatchString(path.Base(filename)) {
+		return false, false
+	}
+	return true, EventDir.Match(dir)
+}
+
+func (c *collector) collect(fs vfs.FileSystem, filename string, root string) mediacleaner.ContextJob {
+	ok, inEvent := renamed(filename)
+	if !ok || inEvent != undoFlag || mediacleaner.IsSidecar(filename) {
+		// sidecars are moved along with their media file
+		return nil
+	}
+
+	date, err := mediacleaner.GetDateFromFilename(filename)
+	if err != nil {
+		return nil
+	}
+
+	m := &media{filename: filename, date: date}
+	if distanceFlag > 0 && !undoFlag {
+		if exif, err := mediacleaner.ReadExif(path.Join(root, filename)); err == nil {
+			if position, err := exif.Get("GPS Position"); err == nil {
+				m.lat, m.lon, err = mediacleaner.ParseGPSPosition(position)
+				m.hasGPS = err == nil
+			}
+		}
+	}
+
+	c.mu.Lock()
+	if _, found := c.fs[root]; !found {
+		c.roots = append(c.roots, root)
+		c.fs[root] = fs
+	}
+	c.files[root] = append(c.files[root], m)
+	c.mu.Unlock()
+	return nil
+}
+
+// cluster splits the files into events.  A new event is started whenever
+// the time between consecutive files exceeds the gap or, when a distance
+// is given, consecutive files with GPS positions are further apart than
+// the distance
+func cluster(files []*media) [][]*media {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].date.Equal(files[j].date) {
+			return files[i].filename < files[j].filename
+		}
+		return files[i].date.Before(files[j].date)
+	})
+
+	events := [][]*media{}
+	var last *media
+	var lastGPS *media
+	for _, m := range files {
+		split := last == nil || m.date.Sub(last.date) > gapFlag
+		if !split && distanceFlag > 0 && m.hasGPS && lastGPS != nil {
+			split = mediacleaner.Distance(lastGPS.lat, lastGPS.lon, m.lat, m.lon) > distanceFlag
+		}
+
+		if split {
+			events = append(events, []*media{})
+			lastGPS = nil
+		}
+		events[len(events)-1] = append(events[len(events)-1], m)
+
+		last = m
+		if m.hasGPS {
+			lastGPS = m
+		}
+	}
+	return events
+}
+
+// eventDir returns the directory for an event
+func eventDir(event []*media) string {
+	start := event[0].date
+	return path.Join(start.Format("/2006"), fmt.Sprintf("%s %s", start.Format("2006-01-02"), namesFlag.lookup(start)))
+}
+
+// readRecord reads the RecordFile of the event directory, it maps the names
+// of the files in the directory to the directories they were moved from
+func readRecord(fs vfs.FileSystem, dir string) map[string]string {
+	record := make(map[string]string)
+	filename := path.Join(dir, RecordFile)
+	if _, err := fs.Stat(filename); err != nil {
+		return record
+	}
+
+	data, err := vfs.ReadFile(fs, filename)
+	if err != nil {
+		mediacleaner.Errorf("Failed to read %q: %v", filename, err)
+		return record
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.SplitN(line, "\t", 2); len(fields) == 2 {
+			record[fields[0]] = fields[1]
+		}
+	}
+	return record
+}
+
+// writeRecord replaces the RecordFile of the event directory, it is removed
+// once the record is empty
+func writeRecord(fs vfs.FileSystem, dir string, record map[string]string) error {
+	filename := path.Join(dir, RecordFile)
+	if len(record) == 0 {
+		if err := fs.Remove(filename); err != nil && !vfs.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	names := []string{}
+	for name := range record {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	builder := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(builder, "%s\t%s\n", name, record[name])
+	}
+	return vfs.WriteFile(fs, filename, []byte(builder.String()), 0640)
+}
+
+// job moves a file, and its sidecars, into or out of an event directory
+type job struct {
+	fs          vfs.FileSystem
+	filename    string
+	newFilename string
+	sidecars    []string
+}
+
+func (jb *job) Name() string {
+	return jb.filename
+}
+
+func (jb *job) Check() error {
+	if _, err := jb.fs.Stat(jb.filename); vfs.IsNotExist(err) {
+		return &mediacleaner.CheckError{Cause: errNoFile}
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := jb.fs.Stat(jb.newFilename); err == nil {
+		return &mediacleaner.CheckError{Cause: errExists}
+	}
+
+	var err error
+	jb.sidecars, err = mediacleaner.Sidecars(jb.fs, jb.filename)
+	return err
+}
+
+func (jb *job) Execute() error {
+	if dryRunFlag {
+		mediacleaner.Infof("Would move %q to %q", jb.filename, jb.newFilename)
+		return nil
+	}
+
+	dir := path.Dir(jb.newFilename)
+	err := vfs.MkdirAll(jb.fs, dir, 0750)
+	if err != nil {
+		return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed creating directory %q", dir), Cause: err}
+	}
+
+	// sidecars keep their names, which already match the file's
+	renames := [][2]string{{jb.filename, jb.newFilename}}
+	for _, sidecar := range jb.sidecars {
+		renames = append(renames, [2]string{sidecar, path.Join(dir, path.Base(sidecar))})
+	}
+
+	for _, rename := range renames {
+		err = jb.fs.Rename(rename[0], rename[1])
+		if err != nil {
+			return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to rename %q to %q", rename[0], rename[1]), Cause: err}
+		}
+	}
+	mediacleaner.Infof("Moved %q to %q", jb.filename, jb.newFilename)
+
+	// the event directory records where the file came from so that undo
+	// can put it back, even in a directory named with a place or device
+	base := path.Base(jb.filename)
+	if undoFlag {
+		record := readRecord(jb.fs, path.Dir(jb.filename))
+		delete(record, base)
+		err = writeRecord(jb.fs, path.Dir(jb.filename), record)
+	} else {
+		record := readRecord(jb.fs, dir)
+		record[base] = path.Dir(jb.filename)
+		err = writeRecord(jb.fs, dir, record)
+	}
+	if err != nil {
+		mediacleaner.Errorf("Failed to update %s: %v", RecordFile, err)
+	}
+
+	// remove the directory the file came from once it is empty
+	if entries, err := vfs.Glob(jb.fs, path.Join(path.Dir(jb.filename), "*")); err == nil && len(entries) == 0 {
+		jb.fs.Remove(path.Dir(jb.filename))
+	}
+	jb.filename = jb.newFilename
+	return nil
+}
+
+// jobs creates the jobs that move files into their event directories, or
+// back to their month directories when undoing
+func jobs(fs vfs.FileSystem, files []*media) []mediacleaner.Job {
+	jbs := []mediacleaner.Job{}
+	if undoFlag {
+		records := make(map[string]map[string]string)
+		for _, m := range files {
+			dir := path.Dir(m.filename)
+			if _, found := records[dir]; !found {
+				records[dir] = readRecord(fs, dir)
+			}
+
+			// files moved before the record was kept go to their month
+			origin, found := records[dir][path.Base(m.filename)]
+			if !found {
+				origin = m.date.Format("/2006/01")
+			}
+			jbs = append(jbs, &job{fs: fs, filename: m.filename, newFilename: path.Join(origin, path.Base(m.filename))})
+		}
+		return jbs
+	}
+
+	for _, event := range cluster(files) {
+		if len(event) < minSizeFlag {
+			continue
+		}
+
+		dir := eventDir(event)
+		for _, m := range event {
+			jbs = append(jbs, &job{fs: fs, filename: m.filename, newFilename: path.Join(dir, path.Base(m.filename))})
+		}
+	}
+	return jbs
+}
+
+// RegisterFlags adds the event options to the flag set
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&gapFlag, "gap", gapFlag, "gap - start a new event when there is more than this much time between files")
+	flags.Float64Var(&distanceFlag, "distance", distanceFlag, "distance - start a new event when files with GPS positions are more than this many kilometers apart (0 disables)")
+	flags.IntVar(&minSizeFlag, "min-size", minSizeFlag, "min-size - minimum number of files in an event, smaller groups are left in their month directory")
+	flags.StringVar(&nameFlag, "name", nameFlag, "name - name given to events that aren't named by -names")
+	flags.Var(&namesFlag, "names", "names - file of \"YYYY-MM-DD YYYY-MM-DD name\" lines naming the events that start within each date range")
+	flags.BoolVar(&undoFlag, "undo", false, "undo - move files in event directories back to the directory they were moved from")
+	flags.BoolVar(&dryRunFlag, "n", false, "dry run - print what would be moved without changing anything")
+}
+
+// Run scans the roots for renamed files and moves them into event
+// directories, or back out of them with -undo.  It returns the exit code
+func Run(roots []string) int {
+	if mediacleaner.WatchFlag {
+		mediacleaner.Errorf("%v", errNoWatch)
+		return 1
+	}
+
+	c := newCollector()
+	p := mediacleaner.Start(roots, c.collect)
+	p.Wait()
+	if p.Stopped() {
+		// the scan didn't finish, so the events would be incomplete
+		return p.ExitCode()
+	}
+
+	// the files are moved once the scan is done, a signal still stops the
+	// moves and a second one cancels the move in progress
+	code := 0
+	for _, root := range c.roots {
+		for _, jb := range jobs(c.fs[root], c.files[root]) {
+			if p.Stopped() {
+				return mediacleaner.ExitIncomplete
+			}
+
+			if err := mediacleaner.RunJob(p.Context(), mediacleaner.Adapt(jb)); err != nil {
+				code = 1
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+func TestEventNames(t *testing.T) {
+	tempdir, _ := ioutil.TempDir("", "events_test")
+	defer os.RemoveAll(tempdir)
+
+	tests := []struct {
+		name    string
+		content string
+		date    time.Time
+		want    string
+		wantErr bool
+	}{
+		{"first day", "# trips\n2019-07-10 2019-07-20 Paris Trip\n", time.Date(2019, 7, 10, 8, 0, 0, 0, time.UTC), "Paris Trip", false},
+		{"last day", "2019-07-10 2019-07-20 Paris Trip\n", time.Date(2019, 7, 20, 23, 0, 0, 0, time.UTC), "Paris Trip", false},
+		{"outside", "2019-07-10 2019-07-20 Paris Trip\n", time.Date(2019, 7, 21, 0, 0, 0, 0, time.UTC), "Event", false},
+		{"unsafe name", "2019-07-10 2019-07-20 Paris/London\n", time.Date(2019, 7, 11, 0, 0, 0, 0, time.UTC), "ParisLondon", false},
+		{"backwards", "2019-07-20 2019-07-10 Paris Trip\n", time.Time{}, "", true},
+		{"no name", "2019-07-10 2019-07-20\n", time.Time{}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := tempdir + "/names.txt"
+			ioutil.WriteFile(filename, []byte(test.content), 0640)
+			names := eventNames{}
+			err := names.Set(filename)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Wanted error got nil")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if got := names.lookup(test.date); test.want != got {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCluster(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2019, 7, d, h, 0, 0, 0, time.UTC) }
+	files := []*media{
+		{filename: "c", date: day(14, 18), hasGPS: true, lat: 48.85, lon: 2.35},
+		{filename: "a", date: day(14, 9), hasGPS: true, lat: 48.85, lon: 2.35},
+		{filename: "b", date: day(14, 12)},
+		{filename: "d", date: day(15, 10), hasGPS: true, lat: 51.5, lon: -0.12},
+		{filename: "e", date: day(20, 10)},
+	}
+
+	tests := []struct {
+		name     string
+		gap      time.Duration
+		distance float64
+		want     [][]string
+	}{
+		{"gap", 24 * time.Hour, 0, [][]string{{"a", "b", "c", "d"}, {"e"}}},
+		{"short gap", 8 * time.Hour, 0, [][]string{{"a", "b", "c"}, {"d"}, {"e"}}},
+		{"distance", 24 * time.Hour, 100, [][]string{{"a", "b", "c"}, {"d"}, {"e"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gapFlag, distanceFlag = test.gap, test.distance
+			defer func() { gapFlag, distanceFlag = 24*time.Hour, 0 }()
+
+			got := [][]string{}
+			for _, event := range cluster(files) {
+				names := []string{}
+				for _, m := range event {
+					names = append(names, m.filename)
+				}
+				got = append(got, names)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestJobs(t *testing.T) {
+	minSizeFlag = 2
+	defer func() { minSizeFlag = 5 }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	vfs.MkdirAll(fs, "/2019/07", 0750)
+	vfs.MkdirAll(fs, "/2019/08", 0750)
+
+	filenames := []string{
+		"/2019/07/2019_07_14_09:00:00_0000.jpg",
+		"/2019/07/2019_07_14_09:00:00_0000.xmp",
+		"/2019/07/2019_07_14_12:00:00_0000.mov",
+		"/2019/07-Paris/2019_07_14_15:00:00_0000.jpg",
+		"/2019/07/pixel_6/2019_07_14_18:00:00_0000.jpg",
+		"/2019/08/2019_08_01_12:00:00_0000.jpg",
+		"/2019/07/IMG_1234.jpg",
+	}
+	for _, filename := range filenames {
+		vfs.MkdirAll(fs, path.Dir(filename), 0750)
+		vfs.WriteFile(fs, filename, []byte{}, 0640)
+	}
+
+	scan := func() []*media {
+		c := newCollector()
+		vfs.Walk(fs, "/", func(filename string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				c.collect(fs, filename, tempdir)
+			}
+			return err
+		})
+		return c.files[tempdir]
+	}
+
+	exists := func(filenames ...string) {
+		t.Helper()
+		for _, filename := range filenames {
+			if _, err := fs.Stat(filename); err != nil {
+				t.Errorf("Wanted %q to exist: %v", filename, err)
+			}
+		}
+	}
+
+	for _, jb := range jobs(fs, scan()) {
+		mediacleaner.RunJob(context.Background(), mediacleaner.Adapt(jb))
+	}
+	exists(
+		"/2019/2019-07-14 Event/2019_07_14_09:00:00_0000.jpg",
+		"/2019/2019-07-14 Event/2019_07_14_09:00:00_0000.xmp",
+		"/2019/2019-07-14 Event/2019_07_14_12:00:00_0000.mov",
+		"/2019/2019-07-14 Event/2019_07_14_15:00:00_0000.jpg",
+		"/2019/2019-07-14 Event/2019_07_14_18:00:00_0000.jpg",
+		"/2019/08/2019_08_01_12:00:00_0000.jpg",
+		"/2019/07/IMG_1234.jpg",
+	)
+
+	undoFlag = true
+	defer func() { undoFlag = false }()
+	for _, jb := range jobs(fs, scan()) {
+		mediacleaner.RunJob(context.Background(), mediacleaner.Adapt(jb))
+	}
+	exists(filenames...)
+
+	if _, err := fs.Stat("/2019/2019-07-14 Event"); !vfs.IsNotExist(err) {
+		t.Errorf("Wanted empty event directory to be removed, got %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	minSizeFlag = 2
+	mediacleaner.ScanFlag = true
+	defer func() { minSizeFlag, mediacleaner.ScanFlag = 5, false }()
+
+	tests := []struct {
+		name     string
+		blocked  bool
+		wantCode int
+	}{
+		{"moved", false, 0},
+		{"failed", true, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir, _ := ioutil.TempDir("", "osfs_test")
+			defer os.RemoveAll(tempdir)
+			fs := vfs.NewOsFs(tempdir)
+			vfs.MkdirAll(fs, "/2019/07", 0750)
+			vfs.WriteFile(fs, "/2019/07/2019_07_14_09:00:00_0000.jpg", []byte{}, 0640)
+			vfs.WriteFile(fs, "/2019/07/2019_07_14_12:00:00_0000.jpg", []byte{}, 0640)
+			if test.blocked {
+				// a file in the way of the event directory
+				vfs.WriteFile(fs, "/2019/2019-07-14 Event", []byte{}, 0640)
+			}
+
+			if got := Run([]string{tempdir}); test.wantCode != got {
+				t.Errorf("Wanted exit code %d got %d", test.wantCode, got)
+			}
+		})
+	}
+}
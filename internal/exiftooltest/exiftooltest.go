@@ -0,0 +1,168 @@
+// Package exiftooltest fakes exiftool's -stay_open mode for the tests of
+// the packages that use the shared exiftool process.  The fake is the test
+// binary itself, started to run only TestFakeExifTool, which must call Run
+package exiftooltest
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/abates/goexiftool"
+)
+
+// Mock makes the shared exiftool process run the fake.  When output is
+// given, reads print that file instead of the file that is read.  The
+// returned function stops the fake using stop so that the next test starts
+// a fresh one.  goexiftool doesn't copy the command's environment, so the
+// helper process variable must be inherited from this process
+func Mock(stop func() error, output ...string) func() {
+	goexiftool.ExifTool = exec.Command(os.Args[0], append([]string{"-test.run=TestFakeExifTool", "--"}, output...)...)
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	return func() {
+		stop()
+		goexiftool.ExifTool = nil
+		os.Unsetenv("GO_WANT_HELPER_PROCESS")
+	}
+}
+
+// Run emulates exiftool when the test binary was started by Mock and
+// returns immediately otherwise.  Each file's content is printed as its
+// metadata along with the fake's process id.  Files with a "File Type :
+// crash" line make the fake exit the first time they are read and files
+// with "File Type : hang" make it stop responding.  Tag assignments, such
+// as -Title=x, replace the tag's line in the file, -AllDates sets the
+// Date/Time Original.  Like exiftool, a copy of the file with "_original"
+// appended is kept unless -overwrite_original is given
+func Run() {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	output := ""
+	for i, arg := range os.Args {
+		if arg == "--" && i+1 < len(os.Args) && os.Args[i+1] != "-stay_open" {
+			output = os.Args[i+1]
+			break
+		}
+	}
+
+	files := []string{}
+	options := []string{}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "False" {
+			break
+		} else if strings.HasPrefix(line, "-execute") {
+			if tags := tagLines(options); len(tags) > 0 {
+				write(files, tags, contains(options, "-overwrite_original"))
+			} else {
+				read(files, output)
+			}
+			fmt.Printf("{ready%s}\n", strings.TrimPrefix(line, "-execute"))
+			files, options = nil, nil
+		} else if strings.HasPrefix(line, "-") {
+			options = append(options, line)
+		} else {
+			files = append(files, line)
+		}
+	}
+	os.Exit(0)
+}
+
+func contains(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// tagLines converts the tag assignments in the options to the lines that
+// exiftool would print for them
+func tagLines(options []string) map[string]string {
+	tags := make(map[string]string)
+	for _, option := range options {
+		if !strings.Contains(option, "=") {
+			continue
+		}
+
+		tag := strings.SplitN(strings.TrimPrefix(option, "-"), "=", 2)
+		if tag[0] == "AllDates" {
+			tag[0] = "Date/Time Original"
+		}
+		tags[tag[0]] = tag[1]
+	}
+	return tags
+}
+
+func read(files []string, output string) {
+	for _, filename := range files {
+		source := filename
+		if output != "" {
+			source = output
+		}
+
+		content, err := ioutil.ReadFile(source)
+		if err != nil {
+			continue
+		}
+
+		if strings.Contains(string(content), "File Type : hang") {
+			time.Sleep(time.Hour)
+		}
+
+		if strings.Contains(string(content), "File Type : crash") {
+			if _, err := os.Stat(source + ".crashed"); os.IsNotExist(err) {
+				ioutil.WriteFile(source+".crashed", nil, 0640)
+				os.Exit(1)
+			}
+		}
+
+		if len(files) > 1 {
+			fmt.Printf("======== %s\n", filename)
+		}
+		fmt.Printf("%sPid : %d\n", content, os.Getpid())
+	}
+	fmt.Printf("    %d image files read\n", len(files))
+}
+
+func write(files []string, tags map[string]string, overwrite bool) {
+	updated := 0
+	for _, filename := range files {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+
+		if !overwrite {
+			ioutil.WriteFile(filename+"_original", content, 0640)
+		}
+
+		lines := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			if _, found := tags[strings.TrimSpace(strings.SplitN(line, ":", 2)[0])]; line != "" && !found {
+				lines = append(lines, line)
+			}
+		}
+
+		for tag, value := range tags {
+			lines = append(lines, fmt.Sprintf("%s : %s", tag, value))
+		}
+
+		if ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0640) == nil {
+			updated++
+		}
+	}
+
+	fmt.Printf("    %d image files updated\n", updated)
+	if updated < len(files) {
+		fmt.Printf("    %d files weren't updated due to errors\n", len(files)-updated)
+	}
+}
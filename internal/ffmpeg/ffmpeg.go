@@ -0,0 +1,286 @@
+// Package ffmpeg runs ffmpeg and ffprobe.  The programs are looked up in
+// the PATH when a process is started, not when the package is loaded, so
+// commands that never use them work without them being installed
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mh-orange/cmd"
+)
+
+var (
+	// program is the ffmpeg that is started unless Ffmpeg is replaced
+	program = &prefixCommand{path: "ffmpeg", args: []string{"-hide_banner", "-nostdin", "-nostats", "-progress", "pipe:2"}}
+
+	// Ffmpeg and Ffprobe create the processes that are run, they are
+	// replaced in tests
+	Ffmpeg  cmd.Command = program
+	Ffprobe cmd.Command = cmd.New("ffprobe", "-hide_banner", "-v", "error", "-print_format", "json", "-sexagesimal", "-show_format", "-show_streams")
+
+	// mu guards Ffmpeg while it is wrapped and the prefix of program
+	mu sync.Mutex
+
+	// progressLine matches the key=value lines written by -progress
+	progressLine = regexp.MustCompile(`^([a-z_]+)=\s*(\S+)$`)
+
+	// durationLine matches the length of the input in ffmpeg's log
+	durationLine = regexp.MustCompile(`^Duration: (\d+:\d+:\d+(?:\.\d+)?)`)
+)
+
+// Wrap replaces the command that ffmpeg is started with by the one
+// returned from wrap, which is passed the current command
+func Wrap(wrap func(command cmd.Command) cmd.Command) {
+	mu.Lock()
+	Ffmpeg = wrap(Ffmpeg)
+	mu.Unlock()
+}
+
+// Prefix runs ffmpeg with another command, such as nice, that is given the
+// path and arguments of ffmpeg.  Commands that wrap ffmpeg are kept
+func Prefix(args ...string) {
+	mu.Lock()
+	program.prefix = args
+	mu.Unlock()
+}
+
+// prefixCommand is a command that is started by its prefix, when it has one
+type prefixCommand struct {
+	path   string
+	args   []string
+	prefix []string
+}
+
+func (pc *prefixCommand) Path() string        { return pc.path }
+func (pc *prefixCommand) SetPath(path string) { pc.path = path }
+
+func (pc *prefixCommand) Process() cmd.Process {
+	mu.Lock()
+	args := append(append(append([]string{}, pc.prefix...), pc.path), pc.args...)
+	mu.Unlock()
+	return cmd.New(args[0], args[1:]...).Process()
+}
+
+func ffmpeg() cmd.Command {
+	mu.Lock()
+	defer mu.Unlock()
+	return Ffmpeg
+}
+
+// Progress is how far a transcode has got
+type Progress struct {
+	// Duration is the length of the input, zero when it isn't known
+	Duration time.Duration
+
+	// Time is the position in the input that has been transcoded
+	Time time.Duration
+}
+
+// Job is a running ffmpeg
+type Job struct {
+	ctx      context.Context
+	proc     cmd.Process
+	progress chan Progress
+	done     chan struct{}
+	err      error
+}
+
+// Transcode starts ffmpeg with the arguments.  When they aren't nil, stdin
+// is read for an input of "-" and stdout receives an output of "-".  ffmpeg
+// is killed as soon as the context is done
+func Transcode(ctx context.Context, stdin io.Reader, stdout io.Writer, args ...string) (*Job, error) {
+	proc := ffmpeg().Process()
+	proc.AppendArgs(args...)
+	if stdin != nil {
+		proc.Stdin(stdin)
+	}
+
+	if stdout != nil {
+		proc.Stdout(stdout)
+	}
+
+	stderr, writer := io.Pipe()
+	proc.Stderr(writer)
+	if err := proc.Start(); err != nil {
+		return nil, err
+	}
+
+	job := &Job{ctx: ctx, proc: proc, progress: make(chan Progress, 1), done: make(chan struct{})}
+	go job.run(stderr)
+	go func() {
+		select {
+		case <-ctx.Done():
+			proc.Kill()
+		case <-job.done:
+		}
+	}()
+	return job, nil
+}
+
+// run reads ffmpeg's log and progress until it exits
+func (job *Job) run(stderr io.Reader) {
+	defer close(job.done)
+	defer close(job.progress)
+
+	log := []string{}
+	progress := Progress{}
+	scanner := bufio.NewScanner(stderr)
+	scanner.Split(scanLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if matches := durationLine.FindStringSubmatch(line); matches != nil {
+			progress.Duration, _ = parseTime(matches[1])
+		} else if matches := progressLine.FindStringSubmatch(line); matches != nil {
+			switch matches[1] {
+			case "out_time":
+				progress.Time, _ = parseTime(matches[2])
+			case "progress":
+				select {
+				case job.progress <- progress:
+				default:
+				}
+			}
+		} else if line != "" {
+			log = append(log, line)
+		}
+	}
+	// keep ffmpeg from blocking if a line was too long to scan
+	io.Copy(ioutil.Discard, stderr)
+
+	job.err = job.proc.Wait()
+	if job.err != nil && len(log) > 0 {
+		if len(log) > 2 {
+			log = log[len(log)-2:]
+		}
+		job.err = errors.New(strings.Join(log, "\n"))
+	}
+}
+
+// Progress receives ffmpeg's progress, updates are dropped while the
+// previous one hasn't been received.  It is closed when ffmpeg exits
+func (job *Job) Progress() <-chan Progress {
+	return job.progress
+}
+
+// Wait waits for ffmpeg to exit.  The context's error is returned if
+// ffmpeg was killed because the context is done
+func (job *Job) Wait() error {
+	<-job.done
+	if job.ctx.Err() != nil {
+		return job.ctx.Err()
+	}
+	return job.err
+}
+
+// scanLines splits ffmpeg's log, which ends lines with \r as well as \n
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	} else if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// parseTime parses the H:MM:SS.ffffff times used by ffmpeg and ffprobe
+func parseTime(str string) (time.Duration, error) {
+	var hours, minutes int
+	var seconds float64
+	if _, err := fmt.Sscanf(str, "%d:%d:%f", &hours, &minutes, &seconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second)), nil
+}
+
+// Info is the part of ffprobe's description of a file that is used
+type Info struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+	} `json:"streams"`
+}
+
+// Duration returns the length of the file, zero if it isn't known
+func (info *Info) Duration() time.Duration {
+	duration, _ := parseTime(info.Format.Duration)
+	return duration
+}
+
+// IsVideo determines if the file has a video stream
+func (info *Info) IsVideo() bool {
+	for _, stream := range info.Streams {
+		if stream.CodecType == "video" {
+			return true
+		}
+	}
+	return false
+}
+
+// waitProcess waits for the process to exit, killing it if the context is
+// done first
+func waitProcess(ctx context.Context, proc cmd.Process) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			proc.Kill()
+		case <-done:
+		}
+	}()
+
+	err := proc.Wait()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// Probe describes the file using ffprobe.  ffprobe is killed if the
+// context is done before it finishes
+func Probe(ctx context.Context, filename string) (*Info, error) {
+	proc := Ffprobe.Process()
+	proc.AppendArgs(filename)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	proc.Stdout(stdout)
+	proc.Stderr(stderr)
+
+	err := proc.Start()
+	if err == nil {
+		err = waitProcess(ctx, proc)
+		if err != nil && ctx.Err() == nil && stderr.Len() > 0 {
+			err = errors.New(strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	return info, json.Unmarshal(stdout.Bytes(), info)
+}
+
+// IsVideo determines if ffprobe finds a video stream in the file
+func IsVideo(ctx context.Context, filename string) (bool, error) {
+	info, err := Probe(ctx, filename)
+	if err != nil {
+		return false, err
+	}
+	return info.IsVideo(), nil
+}
@@ -0,0 +1,84 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mh-orange/cmd"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"0:00:01.000000", time.Second, false},
+		{"01:02:03.50", time.Hour + 2*time.Minute + 3500*time.Millisecond, false},
+		{"N/A", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := parseTime(test.input)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if test.want != got {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	tests := []struct {
+		name         string
+		stderr       string
+		waitErr      error
+		wantProgress []Progress
+		wantErr      string
+	}{
+		{"progress", "  Duration: 00:00:02.00, start: 0.000000\nout_time=00:00:01.000000\nprogress=continue\r", nil, []Progress{{Duration: 2 * time.Second, Time: time.Second}}, ""},
+		{"log", "first\nsecond\nthird\n", errors.New("exit status 1"), nil, "second\nthird"},
+		{"no log", "", errors.New("exit status 1"), nil, "exit status 1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oldFfmpeg := Ffmpeg
+			Ffmpeg = &cmd.TestCmd{Stderr: []byte(test.stderr), WaitErr: test.waitErr}
+			defer func() { Ffmpeg = oldFfmpeg }()
+
+			job, err := Transcode(context.Background(), nil, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := []Progress{}
+			for progress := range job.Progress() {
+				got = append(got, progress)
+			}
+
+			if len(test.wantProgress) != len(got) {
+				t.Errorf("Wanted progress %v got %v", test.wantProgress, got)
+			} else {
+				for i, want := range test.wantProgress {
+					if want != got[i] {
+						t.Errorf("Wanted progress %v got %v", want, got[i])
+					}
+				}
+			}
+
+			err = job.Wait()
+			if test.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Errorf("Wanted error %q got %v", test.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+var (
+	// bmffTypes are the box types that ISO base media files (MP4, MOV, HEIC)
+	// start with.  Old QuickTime files don't always begin with ftyp
+	bmffTypes = map[string]bool{"ftyp": true, "moov": true, "mdat": true, "wide": true, "free": true, "skip": true}
+
+	// quickTimeEpoch is the start of time for MP4/MOV dates
+	quickTimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+type box struct {
+	typ string
+
+	// offset and size of the box's content, following the header
+	offset int64
+	size   int64
+}
+
+// boxes reads the boxes found between offset and end
+func boxes(r io.ReaderAt, offset, end int64) ([]box, error) {
+	found := []box{}
+	header := make([]byte, 8)
+	for offset+8 <= end {
+		if err := readAt(r, header, offset); err != nil {
+			return nil, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+		if size == 1 {
+			large := make([]byte, 8)
+			if err := readAt(r, large, offset+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(large))
+			headerSize = 16
+		} else if size == 0 {
+			// the box extends to the end of the file
+			size = end - offset
+		}
+
+		if size < headerSize || offset+size > end {
+			return nil, ErrCorrupt
+		}
+		found = append(found, box{typ: string(header[4:8]), offset: offset + headerSize, size: size - headerSize})
+		offset += size
+	}
+	return found, nil
+}
+
+func findBox(r io.ReaderAt, parent box, typ string) (box, bool, error) {
+	children, err := boxes(r, parent.offset, parent.offset+parent.size)
+	for _, child := range children {
+		if child.typ == typ {
+			return child, true, nil
+		}
+	}
+	return box{}, false, err
+}
+
+// readBox reads a box's content, limited so that corrupt
+// sizes can't exhaust memory
+func readBox(r io.ReaderAt, b box) ([]byte, error) {
+	if b.size > 1024*1024 {
+		return nil, ErrCorrupt
+	}
+	buf := make([]byte, b.size)
+	return buf, readAt(r, buf, b.offset)
+}
+
+// readBMFF reads MP4/MOV dates from the movie header, or HEIC/HEIF
+// dates from the Exif item
+func readBMFF(r io.ReaderAt, size int64) (*Metadata, error) {
+	file := box{offset: 0, size: size}
+	if meta, found, err := findBox(r, file, "meta"); err != nil {
+		return nil, err
+	} else if found {
+		return readHEIFExif(r, meta)
+	}
+
+	moov, found, err := findBox(r, file, "moov")
+	if err == nil && found {
+		var mvhd box
+		mvhd, found, err = findBox(r, moov, "mvhd")
+		if err == nil && found {
+			return readMVHD(r, mvhd)
+		}
+	}
+
+	if err == nil {
+		err = ErrNoDate
+	}
+	return nil, err
+}
+
+// readMVHD reads the creation and modification times, seconds since 1904,
+// from the movie header.  Zero times are treated as missing
+func readMVHD(r io.ReaderAt, mvhd box) (*Metadata, error) {
+	data, err := readBox(r, mvhd)
+	if err != nil {
+		return nil, err
+	}
+
+	var created, modified uint64
+	switch {
+	case len(data) >= 12 && data[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(data[4:8]))
+		modified = uint64(binary.BigEndian.Uint32(data[8:12]))
+	case len(data) >= 20 && data[0] == 1:
+		created = binary.BigEndian.Uint64(data[4:12])
+		modified = binary.BigEndian.Uint64(data[12:20])
+	default:
+		return nil, ErrCorrupt
+	}
+
+	m := &Metadata{}
+	if created > 0 {
+		m.CreateDate = quickTimeEpoch.Add(time.Duration(created) * time.Second)
+	}
+
+	if modified > 0 {
+		m.ModifyDate = quickTimeEpoch.Add(time.Duration(modified) * time.Second)
+	}
+	return m, nil
+}
+
+// readHEIFExif finds the Exif item in a HEIF meta box using the item
+// information (iinf) and item location (iloc) boxes
+func readHEIFExif(r io.ReaderAt, meta box) (*Metadata, error) {
+	// meta is a full box, skip the version and flags
+	meta.offset += 4
+	meta.size -= 4
+
+	iinf, found, err := findBox(r, meta, "iinf")
+	if err != nil || !found {
+		return nil, ErrNoDate
+	}
+
+	id, found, err := exifItemID(r, iinf)
+	if err != nil || !found {
+		return nil, ErrNoDate
+	}
+
+	iloc, found, err := findBox(r, meta, "iloc")
+	if err != nil || !found {
+		return nil, ErrCorrupt
+	}
+
+	offset, length, err := itemLocation(r, iloc, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// the Exif item starts with the offset to the TIFF header
+	header := make([]byte, 4)
+	if err := readAt(r, header, offset); err != nil {
+		return nil, err
+	}
+	skip := int64(binary.BigEndian.Uint32(header)) + 4
+	if skip > length {
+		return nil, ErrCorrupt
+	}
+	return readTIFF(io.NewSectionReader(r, offset+skip, length-skip))
+}
+
+// exifItemID finds the id of the item whose type is Exif
+func exifItemID(r io.ReaderAt, iinf box) (uint32, bool, error) {
+	data, err := readBox(r, iinf)
+	if err != nil || len(data) < 6 {
+		return 0, false, ErrCorrupt
+	}
+
+	start := int64(6)
+	if data[0] != 0 {
+		start = 8
+	}
+
+	entries, err := boxes(r, iinf.offset+start, iinf.offset+iinf.size)
+	for _, entry := range entries {
+		if entry.typ != "infe" {
+			continue
+		}
+
+		infe, err := readBox(r, entry)
+		if err != nil {
+			return 0, false, err
+		}
+
+		// only version 2 and 3 item info entries have an item type
+		switch {
+		case len(infe) >= 12 && infe[0] == 2 && string(infe[8:12]) == "Exif":
+			return uint32(binary.BigEndian.Uint16(infe[4:6])), true, nil
+		case len(infe) >= 14 && infe[0] == 3 && string(infe[10:14]) == "Exif":
+			return binary.BigEndian.Uint32(infe[4:8]), true, nil
+		}
+	}
+	return 0, false, err
+}
+
+// itemLocation finds the file offset and length of an item.  Only items
+// stored in a single extent in the file itself are supported
+func itemLocation(r io.ReaderAt, iloc box, id uint32) (offset, length int64, err error) {
+	data, err := readBox(r, iloc)
+	if err != nil || len(data) < 8 {
+		return 0, 0, ErrCorrupt
+	}
+
+	version := data[0]
+	offsetSize := int(data[4] >> 4)
+	lengthSize := int(data[4] & 0x0f)
+	baseOffsetSize := int(data[5] >> 4)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(data[5] & 0x0f)
+	}
+
+	pos := 6
+	next := func(size int) (uint64, bool) {
+		if pos+size > len(data) {
+			return 0, false
+		}
+		value := uint64(0)
+		for _, b := range data[pos : pos+size] {
+			value = value<<8 | uint64(b)
+		}
+		pos += size
+		return value, true
+	}
+
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+
+	count, ok := next(idSize)
+	for i := uint64(0); ok && i < count; i++ {
+		var itemID, method, baseOffset, extents uint64
+		itemID, ok = next(idSize)
+		if ok && (version == 1 || version == 2) {
+			method, ok = next(2)
+			method &= 0x0f
+		}
+
+		if ok {
+			_, ok = next(2) // data reference index
+		}
+
+		if ok {
+			baseOffset, ok = next(baseOffsetSize)
+		}
+
+		if ok {
+			extents, ok = next(2)
+		}
+
+		for j := uint64(0); ok && j < extents; j++ {
+			var extentOffset, extentLength uint64
+			_, ok = next(indexSize)
+			if ok {
+				extentOffset, ok = next(offsetSize)
+			}
+
+			if ok {
+				extentLength, ok = next(lengthSize)
+			}
+
+			if ok && uint32(itemID) == id {
+				if method != 0 || extents != 1 {
+					return 0, 0, ErrUnsupported
+				}
+				return int64(baseOffset + extentOffset), int64(extentLength), nil
+			}
+		}
+	}
+	return 0, 0, ErrCorrupt
+}
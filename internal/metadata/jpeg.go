@@ -0,0 +1,60 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	jpegAPP1 = 0xe1
+	jpegSOS  = 0xda
+	jpegEOI  = 0xd9
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// readJPEG finds the Exif APP1 segment.  Segments are read until the image
+// data starts, Exif must come before it
+func readJPEG(r io.ReaderAt, size int64) (*Metadata, error) {
+	offset := int64(2)
+	marker := make([]byte, 4)
+	for offset+4 <= size {
+		if err := readAt(r, marker, offset); err != nil {
+			return nil, err
+		}
+
+		if marker[0] != 0xff {
+			return nil, ErrCorrupt
+		}
+
+		// markers may be preceded by any number of fill bytes
+		if marker[1] == 0xff {
+			offset++
+			continue
+		}
+
+		if marker[1] == jpegSOS || marker[1] == jpegEOI {
+			break
+		}
+
+		length := int64(binary.BigEndian.Uint16(marker[2:4]))
+		if length < 2 {
+			return nil, ErrCorrupt
+		}
+
+		if marker[1] == jpegAPP1 && length-2 > int64(len(exifHeader)) {
+			header := make([]byte, len(exifHeader))
+			if err := readAt(r, header, offset+4); err != nil {
+				return nil, err
+			}
+
+			if bytes.Equal(header, exifHeader) {
+				start := offset + 4 + int64(len(exifHeader))
+				return readTIFF(io.NewSectionReader(r, start, length-2-int64(len(exifHeader))))
+			}
+		}
+		offset += 2 + length
+	}
+	return nil, ErrNoDate
+}
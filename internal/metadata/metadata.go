@@ -0,0 +1,93 @@
+// Package metadata reads capture dates from common media formats without
+// using exiftool.  JPEG and PNG Exif, TIFF based RAW files, HEIC/HEIF Exif
+// items and the MP4/MOV movie header are supported.  Anything else returns
+// ErrUnsupported so that the caller can fall back to exiftool
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// ErrUnsupported indicates that the file's format can't be read
+	ErrUnsupported = errors.New("unsupported file format")
+
+	// ErrNoDate indicates that the file has no date in its metadata
+	ErrNoDate = errors.New("no date found in metadata")
+
+	// ErrCorrupt indicates that the metadata is truncated or malformed
+	ErrCorrupt = errors.New("corrupt metadata")
+)
+
+// Metadata holds the dates found in a file.  Dates that aren't present are
+// zero.  Exif dates have no time zone and are returned as UTC with the wall
+// clock time that was recorded.  MP4/MOV dates are UTC
+type Metadata struct {
+	DateTimeOriginal time.Time
+	CreateDate       time.Time
+	ModifyDate       time.Time
+}
+
+// Date returns the first of DateTimeOriginal, CreateDate and ModifyDate
+// that is set, the same order exiftool's date is chosen in
+func (m *Metadata) Date() (time.Time, error) {
+	for _, t := range []time.Time{m.DateTimeOriginal, m.CreateDate, m.ModifyDate} {
+		if !t.IsZero() {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrNoDate
+}
+
+// ReadFile reads the metadata from the named file
+func ReadFile(filename string) (*Metadata, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(file, fi.Size())
+}
+
+// Read determines the format of the data and reads its metadata
+func Read(r io.ReaderAt, size int64) (*Metadata, error) {
+	header := make([]byte, 12)
+	if err := readAt(r, header, 0); err == ErrCorrupt {
+		return nil, ErrUnsupported
+	} else if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8}):
+		return readJPEG(r, size)
+	case bytes.HasPrefix(header, pngSignature):
+		return readPNG(r, size)
+	case bytes.HasPrefix(header, []byte("II")) || bytes.HasPrefix(header, []byte("MM")):
+		return readTIFF(io.NewSectionReader(r, 0, size))
+	case bmffTypes[string(header[4:8])]:
+		return readBMFF(r, size)
+	}
+	return nil, ErrUnsupported
+}
+
+// readAt fills p from r at off.  Any short read is an error, even when
+// the data was truncated by the end of the file
+func readAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	} else if err == nil || err == io.EOF {
+		err = ErrCorrupt
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestReadFile(t *testing.T) {
+	original := time.Date(2019, 7, 14, 10, 0, 0, 0, time.UTC)
+	created := time.Date(2019, 7, 14, 10, 0, 1, 0, time.UTC)
+	modified := time.Date(2019, 7, 15, 11, 0, 0, 0, time.UTC)
+	exif := &Metadata{DateTimeOriginal: original, CreateDate: created, ModifyDate: modified}
+
+	tests := []struct {
+		filename string
+		want     *Metadata
+		wantDate time.Time
+		wantErr  error
+	}{
+		{"testdata/image.jpg", exif, original, nil},
+		{"testdata/image.dng", exif, original, nil},
+		{"testdata/image.orf", &Metadata{CreateDate: created, ModifyDate: modified}, created, nil},
+		{"testdata/image.png", exif, original, nil},
+		{"testdata/image.heic", exif, original, nil},
+		{"testdata/movie.mp4", &Metadata{CreateDate: original, ModifyDate: original.Add(25 * time.Hour)}, original, nil},
+		{"testdata/movie.mov", &Metadata{CreateDate: original, ModifyDate: original.Add(25 * time.Hour)}, original, nil},
+		{"testdata/nodate.mp4", &Metadata{}, time.Time{}, ErrNoDate},
+		{"testdata/noexif.jpg", nil, time.Time{}, ErrNoDate},
+		{"testdata/../metadata.go", nil, time.Time{}, ErrUnsupported},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			got, err := ReadFile(test.filename)
+			if test.want == nil {
+				if test.wantErr != err {
+					t.Errorf("Wanted error %v got %v", test.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if *test.want != *got {
+				t.Errorf("Wanted %+v got %+v", test.want, got)
+			}
+
+			gotDate, err := got.Date()
+			if test.wantErr != err {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if !test.wantDate.Equal(gotDate) {
+				t.Errorf("Wanted date %v got %v", test.wantDate, gotDate)
+			}
+		})
+	}
+}
+
+func TestReadCorrupt(t *testing.T) {
+	tests := []string{"image.jpg", "image.dng", "image.png", "image.heic", "movie.mp4"}
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			data, err := ioutil.ReadFile("testdata/" + test)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// every truncation must fail cleanly rather than panic
+			for i := 0; i < len(data); i++ {
+				Read(bytes.NewReader(data[0:i]), int64(i))
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// readPNG finds the eXIf chunk, which holds Exif data without the
+// "Exif\0\0" header used by JPEG
+func readPNG(r io.ReaderAt, size int64) (*Metadata, error) {
+	offset := int64(len(pngSignature))
+	chunk := make([]byte, 8)
+	for offset+8 <= size {
+		if err := readAt(r, chunk, offset); err != nil {
+			return nil, err
+		}
+
+		length := int64(binary.BigEndian.Uint32(chunk[0:4]))
+		switch string(chunk[4:8]) {
+		case "eXIf":
+			return readTIFF(io.NewSectionReader(r, offset+8, length))
+		case "IEND":
+			return nil, ErrNoDate
+		}
+
+		// chunk length, type, data and CRC
+		offset += 12 + length
+	}
+	return nil, ErrNoDate
+}
@@ -0,0 +1,152 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+	tagCreateDate       = 0x9004
+
+	typeASCII = 2
+	typeLong  = 4
+	typeIFD   = 13
+
+	// maxIFDEntries guards against reading garbage as a directory
+	maxIFDEntries = 1024
+)
+
+// tiffMagic are the magic numbers following the byte order mark.  Some
+// RAW formats replace TIFF's 42 with their own, Olympus ORF uses "RO"
+// and "SR" and Panasonic RW2 uses 0x55
+var tiffMagic = map[uint16]bool{42: true, 0x4f52: true, 0x5352: true, 0x55: true}
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+}
+
+// readTIFF reads the dates from TIFF structured data, the format used
+// by Exif and most RAW files
+func readTIFF(r io.ReaderAt) (*Metadata, error) {
+	header := make([]byte, 8)
+	if err := readAt(r, header, 0); err != nil {
+		return nil, ErrCorrupt
+	}
+
+	tr := &tiffReader{r: r}
+	switch string(header[0:2]) {
+	case "II":
+		tr.order = binary.LittleEndian
+	case "MM":
+		tr.order = binary.BigEndian
+	default:
+		return nil, ErrUnsupported
+	}
+
+	if !tiffMagic[tr.order.Uint16(header[2:4])] {
+		return nil, ErrUnsupported
+	}
+
+	ifd0, err := tr.readIFD(int64(tr.order.Uint32(header[4:8])))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{}
+	for _, entry := range ifd0 {
+		switch entry.tag {
+		case tagDateTime:
+			m.ModifyDate = tr.date(entry)
+		case tagExifIFD:
+			if entry.typ != typeLong && entry.typ != typeIFD {
+				continue
+			}
+
+			exif, err := tr.readIFD(int64(tr.order.Uint32(entry.value)))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, entry := range exif {
+				switch entry.tag {
+				case tagDateTimeOriginal:
+					m.DateTimeOriginal = tr.date(entry)
+				case tagCreateDate:
+					m.CreateDate = tr.date(entry)
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// readIFD reads the entries of the image file directory at offset.  Only
+// the values of ASCII and LONG entries are loaded
+func (tr *tiffReader) readIFD(offset int64) ([]tiffEntry, error) {
+	buf := make([]byte, 2)
+	if err := readAt(tr.r, buf, offset); err != nil {
+		return nil, ErrCorrupt
+	}
+
+	count := int(tr.order.Uint16(buf))
+	if count > maxIFDEntries {
+		return nil, ErrCorrupt
+	}
+
+	buf = make([]byte, 12*count)
+	if err := readAt(tr.r, buf, offset+2); err != nil {
+		return nil, ErrCorrupt
+	}
+
+	entries := []tiffEntry{}
+	for i := 0; i < count; i++ {
+		raw := buf[i*12 : (i+1)*12]
+		entry := tiffEntry{
+			tag:   tr.order.Uint16(raw[0:2]),
+			typ:   tr.order.Uint16(raw[2:4]),
+			count: tr.order.Uint32(raw[4:8]),
+		}
+
+		switch {
+		case entry.typ == typeASCII && entry.count <= 4:
+			entry.value = raw[8 : 8+entry.count]
+		case entry.typ == typeASCII && entry.count <= 64:
+			entry.value = make([]byte, entry.count)
+			if err := readAt(tr.r, entry.value, int64(tr.order.Uint32(raw[8:12]))); err != nil {
+				return nil, ErrCorrupt
+			}
+		case entry.typ == typeLong || entry.typ == typeIFD:
+			entry.value = raw[8:12]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// date parses an Exif date, "YYYY:MM:DD HH:MM:SS".  Blank
+// and invalid dates are returned as the zero time
+func (tr *tiffReader) date(entry tiffEntry) time.Time {
+	if entry.typ != typeASCII {
+		return time.Time{}
+	}
+
+	str := string(bytes.TrimRight(entry.value, "\x00 "))
+	t, err := time.Parse("2006:01:02 15:04:05", str)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
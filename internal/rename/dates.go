@@ -0,0 +1,217 @@
+package rename
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/abates/mediacleaner/internal/metadata"
+)
+
+var (
+	errNoDate = errors.New("date not found")
+
+	// dateSources are the places a file's date can come from.  The
+	// "exif" source is exiftool's own choice of Date/Time Original,
+	// Create Date or Modify Date
+	dateSources = map[string]func(*job) (time.Time, error){
+		"filename":         func(jb *job) (time.Time, error) { return mediacleaner.GetDateFromFilename(jb.filename) },
+		"exif":             exifDate,
+		"datetimeoriginal": exifTag("Date/Time Original"),
+		"createdate":       exifTag("Create Date"),
+		"modifydate":       exifTag("Modify Date"),
+		"quicktime":        exifTag("Creation Date"),
+		"mtime":            mtime,
+	}
+
+	exifDateLayouts = []string{
+		"2006:01:02 15:04:05",
+		"2006:01:02 15:04:05.00",
+		"2006:01:02 15:04:05-07:00",
+		"2006:01:02 15:04:05.00-07:00",
+		"2006:01:02 15:04:05.000000-07:00",
+	}
+
+	dateSourcesFlag  = dateSourceList{"filename", "exif"}
+	dateConflictFlag = time.Duration(0)
+)
+
+// dateSourceList is a flag.Value holding the date sources in order of
+// precedence
+type dateSourceList []string
+
+func (dsl *dateSourceList) String() string {
+	return strings.Join(*dsl, ",")
+}
+
+func (dsl *dateSourceList) Set(str string) error {
+	sources := dateSourceList{}
+	for _, source := range strings.Split(str, ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if _, found := dateSources[source]; !found {
+			return fmt.Errorf("unknown date source %q", source)
+		}
+		sources = append(sources, source)
+	}
+	*dsl = sources
+	return nil
+}
+
+// wallClock drops any time zone information, keeping the local time of day
+// that was recorded.  Filenames and most exif dates have no zone, so dates
+// are compared by their wall clock rather than as absolute instants
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func parseExifDate(str string) (t time.Time, err error) {
+	for _, layout := range exifDateLayouts {
+		t, err = time.Parse(layout, str)
+		if err == nil {
+			return wallClock(t), nil
+		}
+	}
+	return t, fmt.Errorf("Date has unexpected format: %s", str)
+}
+
+// exifDate reads the date with the native metadata reader, falling
+// back to exiftool for formats it doesn't handle
+func exifDate(jb *job) (time.Time, error) {
+	if m, err := metadata.ReadFile(path.Join(jb.root, jb.filename)); err == nil {
+		if t, err := m.Date(); err == nil {
+			return wallClock(t), nil
+		}
+	}
+
+	exif, err := jb.exif()
+	if err == nil {
+		var t time.Time
+		t, err = exif.GetDate()
+		if err == nil {
+			return wallClock(t), nil
+		}
+		err = errNoDate
+	}
+	return time.Time{}, err
+}
+
+func exifTag(tag string) func(*job) (time.Time, error) {
+	return func(jb *job) (time.Time, error) {
+		exif, err := jb.exif()
+		if err == nil {
+			var value string
+			value, err = exif.Get(tag)
+			if err == nil {
+				var t time.Time
+				if t, err = parseExifDate(value); err == nil {
+					return t, nil
+				}
+			}
+			err = errNoDate
+		}
+		return time.Time{}, err
+	}
+}
+
+func mtime(jb *job) (time.Time, error) {
+	fi, err := jb.fs.Stat(jb.filename)
+	if err == nil {
+		return wallClock(fi.ModTime().Local()), nil
+	}
+	return time.Time{}, err
+}
+
+type sourceDate struct {
+	source string
+	date   time.Time
+}
+
+// dateConflictError indicates that the date sources for a file disagree by
+// more than the allowed threshold
+type dateConflictError struct {
+	dates []sourceDate
+}
+
+func (err *dateConflictError) Error() string {
+	dates := []string{}
+	for _, sd := range err.dates {
+		dates = append(dates, fmt.Sprintf("%s=%s", sd.source, sd.date.Format("2006-01-02 15:04:05")))
+	}
+	return fmt.Sprintf("date sources disagree: %s", strings.Join(dates, ", "))
+}
+
+// date determines the file's date from the first date source that has one.
+// If a conflict threshold has been set then all of the date sources are
+// consulted and any that disagree with the chosen date cause an error
+func (jb *job) date() (time.Time, error) {
+	var exifErr error
+	dates := []sourceDate{}
+	for _, source := range dateSourcesFlag {
+		t, err := dateSources[source](jb)
+		if err == nil {
+			dates = append(dates, sourceDate{source: source, date: t})
+			if dateConflictFlag <= 0 {
+				break
+			}
+		} else if err != errNoDate && err != mediacleaner.ErrUnknownDateFormat && exifErr == nil {
+			exifErr = err
+		}
+	}
+
+	if len(dates) == 0 {
+		if exifErr != nil {
+			return time.Time{}, &mediacleaner.CheckError{Cause: exifErr}
+		}
+		return time.Time{}, &mediacleaner.CheckError{Cause: errNoExifDate}
+	}
+
+	chosen := dates[0].date
+	for _, sd := range dates[1:] {
+		diff := sd.date.Sub(chosen)
+		if diff < 0 {
+			diff = -diff
+		}
+
+		if diff > dateConflictFlag {
+			return chosen, &mediacleaner.CheckError{Cause: &dateConflictError{dates: dates}}
+		}
+	}
+	return chosen, nil
+}
+
+// staleDateTag determines which tag, if any, needs to be written so that the
+// file's metadata carries the date t.  Videos use the QuickTime CreateDate
+// and everything else uses DateTimeOriginal
+func (jb *job) staleDateTag(t time.Time) string {
+	exif, err := jb.exif()
+	if err != nil {
+		return ""
+	}
+
+	tag, label := "DateTimeOriginal", "Date/Time Original"
+	if mimeType, _ := exif.Get("MIME Type"); strings.HasPrefix(mimeType, "video/") {
+		tag, label = "QuickTime:CreateDate", "Create Date"
+	}
+
+	if value, err := exif.Get(label); err == nil {
+		if current, err := parseExifDate(value); err == nil && current.Equal(t) {
+			return ""
+		}
+	}
+	return tag
+}
+
+// writeDate sets the date tag in the file's metadata.  exiftool keeps
+// the unmodified file alongside it with an _original suffix
+func (jb *job) writeDate(ctx context.Context) error {
+	filename := path.Join(jb.root, jb.filename)
+	err := mediacleaner.WriteExifContext(ctx, filename, fmt.Sprintf("-%s=%s", jb.dateTag, jb.newDate.Format("2006:01:02 15:04:05")))
+	if err != nil {
+		err = &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to write %s to %q", jb.dateTag, jb.filename), Cause: err}
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package rename
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+func TestDateSourceList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"filename,exif", "filename,exif", false},
+		{"DateTimeOriginal, filename, QuickTime, mtime", "datetimeoriginal,filename,quicktime,mtime", false},
+		{"filename,foo", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got := dateSourceList{}
+			gotErr := got.Set(test.input)
+			if test.wantErr {
+				if gotErr == nil {
+					t.Errorf("Wanted error got nil")
+				}
+			} else if test.want != got.String() {
+				t.Errorf("Wanted %q got %q", test.want, got.String())
+			}
+		})
+	}
+}
+
+func TestJobDate(t *testing.T) {
+	defer mockExiftool()()
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+
+	files := map[string]string{
+		"/IMG_20190714_100000.jpg": "Date/Time Original : 2019:07:14 10:00:30\nCreate Date : 2019:07:15 10:00:00\n",
+		"/movie.mov":               "Create Date : 2019:07:14 17:00:00\nCreation Date : 2019:07:14 10:00:00-07:00\n",
+		"/nodate.jpg":              "File Type : JPEG\n",
+	}
+	for filename, content := range files {
+		vfs.WriteFile(fs, filename, []byte(content), 0640)
+	}
+	native, _ := ioutil.ReadFile("testdata/native.jpg")
+	vfs.WriteFile(fs, "/native.jpg", native, 0640)
+	modTime := time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local)
+	os.Chtimes(tempdir+"/nodate.jpg", modTime, modTime)
+
+	tests := []struct {
+		name     string
+		filename string
+		sources  string
+		conflict time.Duration
+		want     time.Time
+		wantErr  error
+	}{
+		{"filename first", "/IMG_20190714_100000.jpg", "filename,exif", 0, time.Date(2019, 7, 14, 10, 0, 0, 0, time.UTC), nil},
+		{"exif first", "/IMG_20190714_100000.jpg", "datetimeoriginal,filename", 0, time.Date(2019, 7, 14, 10, 0, 30, 0, time.UTC), nil},
+		{"within threshold", "/IMG_20190714_100000.jpg", "datetimeoriginal,filename", time.Minute, time.Date(2019, 7, 14, 10, 0, 30, 0, time.UTC), nil},
+		{"conflict", "/IMG_20190714_100000.jpg", "datetimeoriginal,filename,createdate", time.Minute, time.Time{}, &dateConflictError{}},
+		{"quicktime zone", "/movie.mov", "quicktime,createdate", 0, time.Date(2019, 7, 14, 10, 0, 0, 0, time.UTC), nil},
+		{"fall through", "/movie.mov", "filename,datetimeoriginal,createdate", 0, time.Date(2019, 7, 14, 17, 0, 0, 0, time.UTC), nil},
+		{"native", "/native.jpg", "exif", 0, time.Date(2019, 7, 14, 10, 0, 0, 0, time.UTC), nil},
+		{"mtime", "/nodate.jpg", "exif,mtime", 0, time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC), nil},
+		{"no date", "/nodate.jpg", "filename,exif", 0, time.Time{}, errNoExifDate},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oldConflict := dateConflictFlag
+			oldSources := dateSourcesFlag
+			defer func() {
+				dateConflictFlag = oldConflict
+				dateSourcesFlag = oldSources
+			}()
+			dateConflictFlag = test.conflict
+			dateSourcesFlag.Set(test.sources)
+
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			got, gotErr := jb.date()
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if _, ok := test.wantErr.(*dateConflictError); ok {
+				if _, ok := gotErr.(*dateConflictError); !ok {
+					t.Errorf("Wanted date conflict got %v", gotErr)
+				}
+			} else if test.wantErr != gotErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			} else if gotErr == nil && !test.want.Equal(got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package rename
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// deviceMakeTags and deviceModelTags are the exiftool labels that hold
+	// the device's make and model.  EXIF is consulted first, followed by the
+	// QuickTime keys written by iPhones and the Android specific tags
+	deviceMakeTags  = []string{"Make", "Android Make", "Android Manufacturer"}
+	deviceModelTags = []string{"Camera Model Name", "Model", "Android Model"}
+
+	// deviceSlugs maps device models, or "make model", to the slug used in
+	// the directory or filename.  Entries loaded with -device-map are added
+	// to, and override, these
+	deviceSlugs = map[string]string{
+		"pixel 6 pro": "pixel6",
+		"pixel 6":     "pixel6",
+		"pixel 7 pro": "pixel7",
+		"pixel 7":     "pixel7",
+	}
+
+	deviceFlag        = deviceMode("")
+	deviceMapFlag     = deviceMap("")
+	deviceUnknownFlag = "unknown"
+)
+
+// deviceMode is a flag.Value that determines where the device slug is
+// placed, if anywhere
+type deviceMode string
+
+func (dm *deviceMode) String() string {
+	return string(*dm)
+}
+
+func (dm *deviceMode) Set(str string) error {
+	switch str {
+	case "", "dir", "filename":
+		*dm = deviceMode(str)
+		return nil
+	}
+	return fmt.Errorf("unknown device placement %q, must be dir or filename", str)
+}
+
+// deviceMap is a flag.Value that loads device slugs from a file.  Each line
+// of the file is "model = slug", blank lines and lines beginning with # are
+// ignored
+type deviceMap string
+
+func (dm *deviceMap) String() string {
+	return string(*dm)
+}
+
+func (dm *deviceMap) Set(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[0]) == "" || slugify(fields[1]) == "" {
+			return fmt.Errorf("%s:%d: expected \"model = slug\"", filename, i)
+		}
+		deviceSlugs[strings.ToLower(strings.TrimSpace(fields[0]))] = slugify(fields[1])
+	}
+	*dm = deviceMap(filename)
+	return scanner.Err()
+}
+
+// slugify lower cases str and keeps only letters and digits so
+// that it is safe to use in filenames
+func slugify(str string) string {
+	slug := []rune{}
+	for _, r := range strings.ToLower(str) {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			slug = append(slug, r)
+		}
+	}
+	return string(slug)
+}
+
+// deviceSlug looks up the slug for a device.  The model is looked up both
+// on its own and prefixed by the make.  Devices that aren't in the table
+// are given a slug made from the model, with any leading make removed
+// ("Canon EOS 80D" by "Canon" becomes "eos80d")
+func deviceSlug(maker, model string) string {
+	maker = strings.TrimSpace(maker)
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return slugify(deviceUnknownFlag)
+	}
+
+	for _, key := range []string{model, maker + " " + model} {
+		if slug, found := deviceSlugs[strings.ToLower(key)]; found {
+			return slug
+		}
+	}
+
+	if len(model) > len(maker) && strings.EqualFold(model[0:len(maker)], maker) {
+		model = model[len(maker):]
+	}
+
+	if slug := slugify(model); slug != "" {
+		return slug
+	}
+	return slugify(deviceUnknownFlag)
+}
+
+// device determines the slug for the device that recorded the file
+func (jb *job) device() string {
+	maker, model := "", ""
+	if exif, err := jb.exif(); err == nil {
+		maker = firstTag(exif.Get, deviceMakeTags)
+		model = firstTag(exif.Get, deviceModelTags)
+	}
+	return deviceSlug(maker, model)
+}
+
+func firstTag(get func(string) (string, error), tags []string) string {
+	for _, tag := range tags {
+		if value, err := get(tag); err == nil && strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package rename
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+)
+
+func TestDeviceSlug(t *testing.T) {
+	tests := []struct {
+		name  string
+		maker string
+		model string
+		want  string
+	}{
+		{"mapped", "Google", "Pixel 6 Pro", "pixel6"},
+		{"unmapped", "Apple", "iPhone 12", "iphone12"},
+		{"make removed", "Canon", "Canon EOS 80D", "eos80d"},
+		{"make kept", "NIKON CORPORATION", "NIKON D750", "nikond750"},
+		{"no model", "Canon", "", "unknown"},
+		{"no letters", "", "---", "unknown"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := deviceSlug(test.maker, test.model)
+			if test.want != got {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDeviceMap(t *testing.T) {
+	tempdir, _ := ioutil.TempDir("", "devicemap_test")
+	defer os.RemoveAll(tempdir)
+
+	tests := []struct {
+		name    string
+		content string
+		model   string
+		want    string
+		wantErr bool
+	}{
+		{"added", "# phones\n\nApple iPhone 12 = Sarah's Phone\n", "iPhone 12", "sarahsphone", false},
+		{"override", "pixel 6 pro = tablet\n", "Pixel 6 Pro", "tablet", false},
+		{"invalid", "Pixel 6 Pro\n", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oldSlugs := deviceSlugs
+			deviceSlugs = map[string]string{"pixel 6 pro": "pixel6"}
+			defer func() { deviceSlugs = oldSlugs }()
+
+			filename := tempdir + "/devices.txt"
+			ioutil.WriteFile(filename, []byte(test.content), 0640)
+			dm := deviceMap("")
+			gotErr := dm.Set(filename)
+			if test.wantErr {
+				if gotErr == nil {
+					t.Errorf("Wanted error got nil")
+				}
+			} else if gotErr != nil {
+				t.Errorf("Unexpected error: %v", gotErr)
+			} else if got := deviceSlug("Apple", test.model); test.want != got {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDevicePlacement(t *testing.T) {
+	defer mockExiftool()()
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+
+	tests := []struct {
+		placement    deviceMode
+		filename     string
+		content      string
+		wantFilename string
+	}{
+		{"dir", "/IMG_20190714_100000.jpg", "Make : Google\nCamera Model Name : Pixel 6 Pro\n", "/2019/07/pixel6/2019_07_14_10:00:00_0000.jpg"},
+		{"dir", "/IMG_20190714_100001.mov", "Make : Apple\nModel : iPhone 12\n", "/2019/07/iphone12/2019_07_14_10:00:01_0000.mov"},
+		{"filename", "/IMG_20190714_100002.jpg", "Make : Canon\nCamera Model Name : Canon EOS 80D\n", "/2019/07/2019_07_14_10:00:02_0000_eos80d.jpg"},
+		{"filename", "/IMG_20190714_100002.mp4", "Android Model : Pixel 6\n", "/2019/07/2019_07_14_10:00:02_0001_pixel6.mp4"},
+		{"filename", "/IMG_20190714_100003.jpg", "File Type : JPEG\n", "/2019/07/2019_07_14_10:00:03_0000_unknown.jpg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			deviceFlag = test.placement
+			defer func() { deviceFlag = "" }()
+
+			vfs.WriteFile(fs, test.filename, []byte(test.content), 0640)
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			err := jb.Check(context.Background())
+			if err == nil {
+				err = jb.Execute(context.Background())
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if test.wantFilename != jb.filename {
+				t.Errorf("Wanted filename %q got %q", test.wantFilename, jb.filename)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package rename
+
+import (
+	"os"
+	"strings"
+
+	"github.com/abates/mediacleaner"
+)
+
+var (
+	placesFlag        = placesFile("")
+	placeDistanceFlag = 50.0
+
+	places mediacleaner.Places
+)
+
+// placesFile is a flag.Value that loads the offline places dataset.  It
+// is a boolean flag so that -places on its own uses the default dataset
+// and -places=cities15000.txt loads a GeoNames cities file
+type placesFile string
+
+func (pf *placesFile) String() string {
+	return string(*pf)
+}
+
+func (pf *placesFile) IsBoolFlag() bool { return true }
+
+func (pf *placesFile) Set(filename string) error {
+	switch filename {
+	case "", "false":
+		places = nil
+		*pf = placesFile("")
+		return nil
+	case "true":
+		places = mediacleaner.DefaultPlaces
+		*pf = placesFile(filename)
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	places, err = mediacleaner.LoadPlaces(file)
+	if err == nil {
+		*pf = placesFile(filename)
+	}
+	return err
+}
+
+// placeName makes a place name safe to use in a directory name
+func placeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+}
+
+// gps finds the coordinates where the file was recorded
+func (jb *job) gps() (lat, lon float64, err error) {
+	exif, err := jb.exif()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if position, err := exif.Get("GPS Position"); err == nil {
+		return mediacleaner.ParseGPSPosition(position)
+	}
+
+	latitude, err1 := exif.Get("GPS Latitude")
+	longitude, err2 := exif.Get("GPS Longitude")
+	if err1 != nil || err2 != nil {
+		return 0, 0, mediacleaner.ErrNoGPS
+	}
+
+	lat, err = mediacleaner.ParseGPSCoordinate(latitude)
+	if err == nil {
+		lon, err = mediacleaner.ParseGPSCoordinate(longitude)
+	}
+	return lat, lon, err
+}
+
+// place reverse geocodes the file's GPS coordinates against the places
+// dataset.  An empty string is returned if the file has no coordinates
+// or there is no place nearby
+func (jb *job) place() string {
+	if len(places) == 0 {
+		return ""
+	}
+
+	lat, lon, err := jb.gps()
+	if err != nil {
+		return ""
+	}
+
+	if p, found := places.Nearest(lat, lon, placeDistanceFlag); found {
+		return placeName(p.Name)
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package rename
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+func TestPlace(t *testing.T) {
+	defer mockExiftool()()
+	pf := placesFile("")
+	if err := pf.Set("testdata/cities.txt"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() { places = nil }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+
+	tests := []struct {
+		filename     string
+		content      string
+		wantFilename string
+	}{
+		{"/IMG_20190714_100000.jpg", "GPS Position : 48 deg 51' 30.24\" N, 2 deg 17' 40.20\" E\n", "/2019/07-Paris/2019_07_14_10:00:00_0000.jpg"},
+		{"/IMG_20190714_100001.mov", "GPS Latitude : 51 deg 30' 26.00\" N\nGPS Longitude : 0 deg 7' 39.00\" W\n", "/2019/07-London/2019_07_14_10:00:01_0000.mov"},
+		{"/IMG_20190714_100002.jpg", "GPS Position : 30 deg 0' 0.00\" N, 40 deg 0' 0.00\" W\n", "/2019/07/2019_07_14_10:00:02_0000.jpg"},
+		{"/IMG_20190714_100003.jpg", "File Type : JPEG\n", "/2019/07/2019_07_14_10:00:03_0000.jpg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			vfs.WriteFile(fs, test.filename, []byte(test.content), 0640)
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			err := jb.Check(context.Background())
+			if err == nil {
+				err = jb.Execute(context.Background())
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if test.wantFilename != jb.filename {
+				t.Errorf("Wanted filename %q got %q", test.wantFilename, jb.filename)
+			}
+
+			jb = &job{fs: fs, root: tempdir, filename: jb.filename}
+			if err := jb.Check(context.Background()); err == nil {
+				t.Errorf("Wanted renamed file to be skipped")
+			}
+		})
+	}
+}
+
+func TestPlacesFlag(t *testing.T) {
+	defer func() { places = nil }()
+
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"true", len(mediacleaner.DefaultPlaces), false},
+		{"testdata/cities.txt", 2, false},
+		{"false", 0, false},
+		{"testdata/missing.txt", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			places = nil
+			pf := placesFile("")
+			err := pf.Set(test.input)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if test.want != len(places) {
+				t.Errorf("Wanted %d places got %d", test.want, len(places))
+			}
+		})
+	}
+}
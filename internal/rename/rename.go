@@ -0,0 +1,377 @@
+// Package rename renames media files by the date they were taken into
+// /YYYY/MM directories
+package rename
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/abates/goexiftool"
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+var (
+	errNoFile           = errors.New("File removed prior to processing")
+	errIsDir            = errors.New("File is a directory")
+	errNoExifDate       = errors.New("Exif data has no known date")
+	errAlreadyProcessed = errors.New("File has already been processed")
+	errLivePhotoMotion  = errors.New("File is the motion half of a Live Photo and will be renamed with its still image")
+	errSidecar          = errors.New("File is a sidecar and will be renamed with its media file")
+	errUnknownPattern   = errors.New("Filename doesn't match a known pattern")
+
+	skipFlag          = false
+	fallbackMtimeFlag = false
+	mtimeMarkerFlag   = "_mtime"
+	unsortedFlag      = false
+	writeExifFlag     = false
+	fixExtFlag        = false
+	unsortedDirFlag   = "/_unsorted"
+)
+
+type job struct {
+	fs          vfs.FileSystem
+	root        string
+	filename    string
+	newFilename string
+	newDir      string
+
+	// prefix and suffix are the parts of newFilename around the number
+	// that GetPrefix adds to tell apart files taken in the same second
+	prefix string
+	suffix string
+
+	// companions are files that are renamed along with the job's file,
+	// such as the motion half of a Live Photo or sidecar files
+	companions []string
+
+	// dateTag is the metadata tag that will be updated
+	// with newDate when -write-exif is set
+	newDate time.Time
+	dateTag string
+
+	mediaFile *goexiftool.MediaFile
+	exifErr   error
+
+	// ctx is the context of the Check or Execute in progress, it
+	// limits how long reading the metadata may take
+	ctx context.Context
+}
+
+func (jb *job) context() context.Context {
+	if jb.ctx == nil {
+		return context.Background()
+	}
+	return jb.ctx
+}
+
+// exif loads the file's metadata using the shared exiftool process.  The
+// metadata is only loaded once per job
+func (jb *job) exif() (*goexiftool.MediaFile, error) {
+	if jb.mediaFile == nil && jb.exifErr == nil {
+		jb.mediaFile, jb.exifErr = mediacleaner.ReadExifContext(jb.context(), path.Join(jb.root, jb.filename))
+		if jb.exifErr != nil {
+			jb.mediaFile = nil
+		}
+	}
+	return jb.mediaFile, jb.exifErr
+}
+
+// sameLivePhoto determines if the other file belongs to the same Live Photo
+// as the job's file.  When both files carry an Apple ContentIdentifier the
+// identifiers must match, otherwise the files are paired by name alone
+func (jb *job) sameLivePhoto(other string) bool {
+	id := ""
+	if exif, err := jb.exif(); err == nil {
+		id, _ = exif.Get("Content Identifier")
+	}
+
+	otherID := ""
+	if exif, err := mediacleaner.ReadExifContext(jb.context(), path.Join(jb.root, other)); err == nil {
+		otherID, _ = exif.Get("Content Identifier")
+	}
+	return id == "" || otherID == "" || id == otherID
+}
+
+// livePhotoMotion finds the motion file that belongs with a Live Photo's
+// still image
+func (jb *job) livePhotoMotion() []string {
+	motion := []string{}
+	if !mediacleaner.LivePhotoStillExts[strings.ToLower(path.Ext(jb.filename))] {
+		return motion
+	}
+
+	companions, _ := mediacleaner.Companions(jb.fs, jb.filename)
+	for _, companion := range companions {
+		if mediacleaner.IsLivePhotoPair(jb.filename, companion) && jb.sameLivePhoto(companion) {
+			motion = append(motion, companion)
+		}
+	}
+	return motion
+}
+
+func (jb *job) Name() string {
+	return jb.filename
+}
+
+// Moved returns the file's name, which is the new name once
+// the job has executed
+func (jb *job) Moved() string {
+	return jb.filename
+}
+
+func (jb *job) Check(ctx context.Context) error {
+	jb.ctx = ctx
+	if fi, err := jb.fs.Stat(jb.filename); vfs.IsNotExist(err) {
+		return &mediacleaner.CheckError{Cause: errNoFile}
+	} else if fi.IsDir() {
+		return &mediacleaner.CheckError{Cause: errIsDir}
+	}
+
+	dir := []byte(path.Dir(jb.filename))
+	if mediacleaner.YearMonthDir.Match(dir) || mediacleaner.YearMonthDayDir.Match(dir) {
+		fn := []byte(path.Base(jb.filename))
+		if mediacleaner.FilePrefix.Match(fn) {
+			return &mediacleaner.CheckError{Cause: errAlreadyProcessed}
+		}
+	}
+
+	if _, err := mediacleaner.GetDateFromFilename(jb.filename); skipFlag && err != nil {
+		return &mediacleaner.CheckError{Cause: errUnknownPattern}
+	}
+
+	if mediacleaner.IsSidecar(jb.filename) {
+		return &mediacleaner.CheckError{Cause: errSidecar}
+	}
+
+	if still := mediacleaner.LivePhotoStill(jb.fs, jb.filename); still != "" && jb.sameLivePhoto(still) {
+		return &mediacleaner.CheckError{Cause: errLivePhotoMotion}
+	}
+
+	marker := ""
+	t, err := jb.date()
+	if ce, ok := err.(*mediacleaner.CheckError); ok && ce.Cause == errNoExifDate && fallbackMtimeFlag {
+		// inferred dates are marked so they can be told apart from trusted ones
+		t, err = mtime(jb)
+		marker = mtimeMarkerFlag
+	}
+
+	if ctx.Err() != nil {
+		// metadata that couldn't be read in time isn't missing
+		return ctx.Err()
+	}
+
+	if err != nil {
+		if reason := unsortedReason(err); unsortedFlag && reason != "" {
+			return jb.unsorted(reason)
+		}
+		return err
+	}
+	jb.newFilename = t.Format("2006_01_02_15:04:05")
+	jb.newDir = t.Format("/2006/01")
+	jb.newDate = t
+	if writeExifFlag && marker == "" {
+		jb.dateTag = jb.staleDateTag(t)
+	}
+
+	if place := jb.place(); place != "" {
+		jb.newDir = fmt.Sprintf("%s-%s", jb.newDir, place)
+	}
+
+	device := ""
+	if deviceFlag == "dir" {
+		jb.newDir = path.Join(jb.newDir, jb.device())
+	} else if deviceFlag == "filename" {
+		device = "_" + jb.device()
+	}
+
+	jb.prefix = jb.newFilename
+	jb.suffix = fmt.Sprintf("%s%s%s", device, marker, jb.extension())
+	jb.newFilename, err = mediacleaner.GetPrefix(jb.fs, jb.newDir, jb.prefix)
+	if err == nil {
+		jb.newFilename = jb.newFilename + jb.suffix
+		err = jb.findCompanions()
+	}
+	return err
+}
+
+// claimName chooses the new name again, with mediacleaner.PrefixLock
+// held, since a concurrent job may have taken the one chosen by Check
+func (jb *job) claimName() (err error) {
+	if jb.prefix != "" {
+		jb.newFilename, err = mediacleaner.GetPrefix(jb.fs, jb.newDir, jb.prefix)
+		jb.newFilename += jb.suffix
+	} else if isUnsorted(jb.newDir) {
+		jb.newFilename = freeName(jb.fs, jb.newDir, path.Base(jb.filename))
+	}
+	return err
+}
+
+// extension returns the canonical extension the file is renamed with.  With
+// -fix-ext it is the extension matching the file's content
+func (jb *job) extension() string {
+	ext := path.Ext(jb.filename)
+	if !fixExtFlag {
+		return mediacleaner.CanonicalExt(ext)
+	}
+
+	mimeType, err := mediacleaner.Sniff(jb.fs, jb.filename)
+	if err != nil {
+		return mediacleaner.CanonicalExt(ext)
+	}
+
+	correct := mediacleaner.CorrectExt(ext, mimeType)
+	if correct != mediacleaner.CanonicalExt(ext) {
+		mediacleaner.Infof("%s holds %s, renaming it with %s", jb.filename, mimeType, correct)
+	}
+	return correct
+}
+
+func (jb *job) findCompanions() error {
+	jb.companions = jb.livePhotoMotion()
+	sidecars, err := mediacleaner.Sidecars(jb.fs, jb.filename)
+	jb.companions = append(jb.companions, sidecars...)
+	return err
+}
+
+// unsortedReason returns the name of the unsorted directory for
+// files that could not be dated
+func unsortedReason(err error) string {
+	if ce, ok := err.(*mediacleaner.CheckError); ok {
+		err = ce.Cause
+	}
+
+	switch err.(type) {
+	case *dateConflictError:
+		return "dateconflict"
+	}
+
+	switch err {
+	case errNoExifDate:
+		return "nodate"
+	case mediacleaner.ErrUnknownDateFormat:
+		return "unknownformat"
+	}
+	return ""
+}
+
+// unsorted sets up the job to move the file into the unsorted directory so
+// that it is out of the way of new uploads and isn't examined again
+func (jb *job) unsorted(reason string) error {
+	jb.newDir = path.Join(unsortedDir(), reason)
+	jb.newFilename = freeName(jb.fs, jb.newDir, path.Base(jb.filename))
+	return jb.findCompanions()
+}
+
+// freeName returns filename, or filename numbered _1, _2 and so on,
+// whichever isn't already in the directory
+func freeName(fs vfs.FileSystem, dir, filename string) string {
+	stem := mediacleaner.Stem(filename)
+	ext := path.Ext(filename)
+	for i := 1; ; i++ {
+		if _, err := fs.Stat(path.Join(dir, filename)); vfs.IsNotExist(err) {
+			return filename
+		}
+		filename = fmt.Sprintf("%s_%d%s", stem, i, ext)
+	}
+}
+
+// unsortedDir returns the unsorted directory as a path from the root, however
+// the flag was written
+func unsortedDir() string {
+	return path.Clean("/" + unsortedDirFlag)
+}
+
+// isUnsorted determines if the file is in the unsorted tree
+func isUnsorted(filename string) bool {
+	dir := unsortedDir()
+	return filename == dir || strings.HasPrefix(filename, dir+"/")
+}
+
+// ExcludeUnsorted adds the unsorted directory to the excluded files so that
+// the walk skips it rather than identifying the files in it on every scan.
+// It must be called after the flags have been parsed
+func ExcludeUnsorted() {
+	mediacleaner.ExcludeFlag = append(mediacleaner.ExcludeFlag, unsortedDir())
+}
+
+// NewJob creates the job that renames the file, files in the
+// unsorted directory are ignored
+func NewJob(fs vfs.FileSystem, filename string, root string) mediacleaner.ContextJob {
+	if isUnsorted(filename) {
+		return nil
+	}
+	return &job{fs: fs, root: root, filename: filename}
+}
+
+func (jb *job) Execute(ctx context.Context) error {
+	jb.ctx = ctx
+	oldStem := mediacleaner.Stem(jb.filename)
+	mediacleaner.PrefixLock.Lock()
+	err := jb.claimName()
+	if err != nil {
+		mediacleaner.PrefixLock.Unlock()
+		return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to choose a name in %q", jb.newDir), Cause: err}
+	}
+
+	err = vfs.MkdirAll(jb.fs, jb.newDir, 0750)
+	if err == nil {
+		newFilename := path.Join(jb.newDir, jb.newFilename)
+		err = jb.fs.Rename(jb.filename, newFilename)
+		if err == nil {
+			jb.filename = newFilename
+		} else {
+			err = &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to rename %q to %q", jb.filename, newFilename), Cause: err}
+		}
+	} else {
+		err = &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed creating directory %q", jb.newDir), Cause: err}
+	}
+
+	// companions share the new name so they stay paired with the file, anything
+	// following the old stem (.MOV, .xmp or .NEF.xmp) is kept as the suffix
+	stem := mediacleaner.Stem(jb.newFilename)
+	for i := 0; err == nil && i < len(jb.companions); i++ {
+		companion := jb.companions[i]
+		suffix := strings.ToLower(strings.TrimPrefix(path.Base(companion), oldStem))
+		if suffix == path.Ext(suffix) {
+			suffix = mediacleaner.CanonicalExt(suffix)
+		}
+		newCompanion := path.Join(jb.newDir, fmt.Sprintf("%s%s", stem, suffix))
+		err = jb.fs.Rename(companion, newCompanion)
+		if err == nil {
+			jb.companions[i] = newCompanion
+		} else {
+			err = &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to rename %q to %q", companion, newCompanion), Cause: err}
+		}
+	}
+	mediacleaner.PrefixLock.Unlock()
+
+	if err == nil && jb.dateTag != "" {
+		err = jb.writeDate(ctx)
+	}
+	return err
+}
+
+// RegisterFlags adds the renamer's options to the flag set
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&skipFlag, "i", false, "ignore - ignore filenames that don't match a known pattern")
+	flags.Var(&dateSourcesFlag, "date-sources", "date-sources - comma separated date sources in order of precedence (filename, exif, datetimeoriginal, createdate, modifydate, quicktime, mtime)")
+	flags.BoolVar(&fallbackMtimeFlag, "fallback-mtime", false, "fallback-mtime - date files that have no other date by their modification time")
+	flags.StringVar(&mtimeMarkerFlag, "mtime-marker", mtimeMarkerFlag, "mtime-marker - added to the name of files dated by -fallback-mtime")
+	flags.BoolVar(&unsortedFlag, "unsorted", false, "unsorted - move files that can't be dated into the unsorted directory, grouped by reason")
+	flags.StringVar(&unsortedDirFlag, "unsorted-dir", unsortedDirFlag, "unsorted-dir - directory, relative to each root, for files that can't be dated. It is never scanned")
+	flags.BoolVar(&writeExifFlag, "write-exif", false, "write-exif - write the date into the file's metadata when it is missing or different, keeping the original file with an _original suffix")
+	flags.BoolVar(&fixExtFlag, "fix-ext", false, "fix-ext - give files the extension matching their content, such as .png for a PNG image named .jpg")
+	flags.Var(&deviceFlag, "device", "device - add a slug of the camera or phone model to the directory (dir) or filename (filename)")
+	flags.Var(&deviceMapFlag, "device-map", "device-map - file of \"model = slug\" lines mapping device models to slugs, unknown models are slugged from the model name")
+	flags.StringVar(&deviceUnknownFlag, "device-unknown", deviceUnknownFlag, "device-unknown - slug used for files that don't record a device model")
+	flags.Var(&placesFlag, "places", "places - add the place a file was taken to its month directory (/2019/07-Paris) using a built in list of large cities, or -places=FILE to use a GeoNames cities file (e.g. cities15000.txt)")
+	flags.Float64Var(&placeDistanceFlag, "place-distance", placeDistanceFlag, "place-distance - maximum distance, in kilometers, from a file's GPS position to the nearest place")
+	flags.IntVar(&mediacleaner.Concurrency, "concurrency", 1, "concurrency - number of files renamed at the same time, exiftool reads files that are checked at the same time with a single command")
+	flags.DurationVar(&dateConflictFlag, "date-conflict", 0, "date-conflict - skip and report files whose date sources disagree by more than this duration (0 disables the check)")
+}
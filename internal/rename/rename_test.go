@@ -0,0 +1,498 @@
+package rename
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/abates/mediacleaner/internal/exiftooltest"
+	"github.com/mh-orange/vfs"
+)
+
+// mockExiftool sets up the fake exiftool so that, without an output file,
+// it prints the media file itself
+func mockExiftool(output ...string) func() {
+	return exiftooltest.Mock(mediacleaner.CloseExifTool, output...)
+}
+
+func TestFakeExifTool(t *testing.T) {
+	exiftooltest.Run()
+}
+
+func TestJobCheck(t *testing.T) {
+	fs := vfs.NewOsFs("testdata")
+	defer fs.Close()
+	tests := []struct {
+		filename        string
+		wantNewDir      string
+		wantNewFilename string
+		wantErr         error
+	}{
+		{"/2010/01", "", "", errIsDir},
+		{"/2010/02", "", "", errNoFile},
+		{"/2010/01/2010_01_13_22:01:37_0000.jpg", "", "", errAlreadyProcessed},
+		{"/2010/01/13/2010_01_13_22:01:37_0000.jpg", "", "", errAlreadyProcessed},
+		{"/noexif.png", "", "", errNoExifDate},
+		{"/nodate.png", "", "", errNoExifDate},
+		{"/IMG_20130525_125511_332.jpg", "/2013/05", "2013_05_25_12:55:11_0000.jpg", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			outfile := fmt.Sprintf("testdata/%s.ffprobe", test.filename[0:len(test.filename)-len(filepath.Ext(test.filename))])
+			if _, err := os.Stat(outfile); err == nil {
+				defer mockExiftool(outfile)()
+			}
+
+			jb := &job{fs: fs, root: "testdata/", filename: test.filename}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr == gotErr {
+				if gotErr == nil {
+					if test.wantNewDir != jb.newDir {
+						t.Errorf("Wanted newDir %q got %q", test.wantNewDir, jb.newDir)
+					}
+
+					if test.wantNewFilename != jb.newFilename {
+						t.Errorf("Wanted newFilename %q got %q", test.wantNewFilename, jb.newFilename)
+					}
+				}
+			} else {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestJobExecute(t *testing.T) {
+	tests := []struct {
+		filename        string
+		wantNewFilename string
+		wantErr         error
+	}{
+		{"/IMG_20130525_125511_332.jpg", "/2013/05/2013_05_25_12:55:11_0000.jpg", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			fs := vfs.NewTempFs()
+			defer fs.Close()
+			fs.Create(test.filename)
+			jb := &job{
+				fs:          fs,
+				filename:    test.filename,
+				newFilename: path.Base(test.wantNewFilename),
+				newDir:      path.Dir(test.wantNewFilename),
+			}
+			gotErr := jb.Execute(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.ExecuteError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr == gotErr {
+				if gotErr == nil {
+					if _, err := fs.Stat(path.Dir(test.wantNewFilename)); err != nil {
+						t.Errorf("Wanted directory to exist got %v", err)
+					}
+
+					if _, err := fs.Stat(test.wantNewFilename); err != nil {
+						t.Errorf("Wanted file to have been renamed, got %v", err)
+					}
+
+					if _, err := fs.Stat(test.filename); !vfs.IsNotExist(err) {
+						t.Errorf("Wanted file to have been renamed, got %v", err)
+					}
+				}
+			} else {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestLivePhoto(t *testing.T) {
+	defer mockExiftool()()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	files := map[string]string{
+		"/IMG_1234.HEIC": "Date/Time Original : 2019:07:14 10:00:00\nContent Identifier : A\n",
+		"/IMG_1234.MOV":  "Content Identifier : A\n",
+		"/IMG_1235.HEIC": "Date/Time Original : 2019:07:14 10:00:00\nContent Identifier : B\n",
+		"/IMG_1235.MOV":  "Content Identifier : C\n",
+	}
+	for filename, content := range files {
+		vfs.WriteFile(fs, filename, []byte(content), 0640)
+	}
+
+	tests := []struct {
+		filename       string
+		wantErr        error
+		wantFilename   string
+		wantCompanions []string
+	}{
+		{"/IMG_1234.MOV", errLivePhotoMotion, "", nil},
+		{"/IMG_1235.MOV", errNoExifDate, "", nil},
+		{"/IMG_1234.HEIC", nil, "/2019/07/2019_07_14_10:00:00_0000.heic", []string{"/2019/07/2019_07_14_10:00:00_0000.mov"}},
+		{"/IMG_1235.HEIC", nil, "/2019/07/2019_07_14_10:00:00_0001.heic", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr != gotErr {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+
+			if gotErr == nil {
+				err := jb.Execute(context.Background())
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				if test.wantFilename != jb.filename {
+					t.Errorf("Wanted filename %q got %q", test.wantFilename, jb.filename)
+				}
+
+				if !reflect.DeepEqual(test.wantCompanions, jb.companions) {
+					t.Errorf("Wanted companions %v got %v", test.wantCompanions, jb.companions)
+				}
+
+				for _, companion := range jb.companions {
+					if _, err := fs.Stat(companion); err != nil {
+						t.Errorf("Wanted %q to exist, got %v", companion, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSidecars(t *testing.T) {
+	fs := vfs.NewTempFs()
+	defer fs.Close()
+	for _, filename := range []string{"/IMG_20190714_100000.NEF", "/IMG_20190714_100000.xmp", "/IMG_20190714_100000.NEF.xmp", "/IMG_20190714_100000.THM"} {
+		fs.Create(filename)
+	}
+
+	jb := &job{fs: fs, filename: "/IMG_20190714_100000.xmp"}
+	gotErr := jb.Check(context.Background())
+	if ce, ok := gotErr.(*mediacleaner.CheckError); !ok || ce.Cause != errSidecar {
+		t.Errorf("Wanted error %v got %v", errSidecar, gotErr)
+	}
+
+	jb = &job{fs: fs, filename: "/IMG_20190714_100000.NEF"}
+	err := jb.Check(context.Background())
+	if err == nil {
+		err = jb.Execute(context.Background())
+	}
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{"/2019/07/2019_07_14_10:00:00_0000.nef", "/2019/07/2019_07_14_10:00:00_0000.thm", "/2019/07/2019_07_14_10:00:00_0000.xmp", "/2019/07/2019_07_14_10:00:00_0000.nef.xmp"}
+	got := append([]string{jb.filename}, jb.companions...)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	for _, filename := range want {
+		if _, err := fs.Stat(filename); err != nil {
+			t.Errorf("Wanted %q to exist, got %v", filename, err)
+		}
+	}
+}
+
+func TestFallbackMtime(t *testing.T) {
+	defer mockExiftool()()
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	vfs.WriteFile(fs, "/noexif.png", []byte("File Type : PNG\n"), 0640)
+	modTime := time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local)
+	os.Chtimes(filepath.Join(tempdir, "noexif.png"), modTime, modTime)
+
+	tests := []struct {
+		name            string
+		fallback        bool
+		wantNewFilename string
+		wantErr         error
+	}{
+		{"disabled", false, "", errNoExifDate},
+		{"enabled", true, "2018_01_02_03:04:05_0000_mtime.png", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fallbackMtimeFlag = test.fallback
+			defer func() { fallbackMtimeFlag = false }()
+
+			jb := &job{fs: fs, root: tempdir, filename: "/noexif.png"}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr != gotErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			} else if gotErr == nil && test.wantNewFilename != jb.newFilename {
+				t.Errorf("Wanted newFilename %q got %q", test.wantNewFilename, jb.newFilename)
+			}
+		})
+	}
+}
+
+func TestUnsorted(t *testing.T) {
+	defer mockExiftool()()
+	unsortedFlag = true
+	defer func() { unsortedFlag = false }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	vfs.MkdirAll(fs, "/_unsorted/nodate", 0750)
+	vfs.WriteFile(fs, "/_unsorted/nodate/noexif.png", nil, 0640)
+	vfs.WriteFile(fs, "/noexif.png", []byte("File Type : PNG\n"), 0640)
+	vfs.WriteFile(fs, "/noexif.xmp", nil, 0640)
+
+	if jb := NewJob(fs, "/_unsorted/nodate/noexif.png", tempdir); jb != nil {
+		t.Errorf("Wanted no job for files in the unsorted directory")
+	}
+
+	jb := NewJob(fs, "/noexif.png", tempdir).(*job)
+	err := jb.Check(context.Background())
+	if err == nil {
+		err = jb.Execute(context.Background())
+	}
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, want := range []string{"/_unsorted/nodate/noexif_1.png", "/_unsorted/nodate/noexif_1.xmp"} {
+		if _, err := fs.Stat(want); err != nil {
+			t.Errorf("Wanted %q to exist, got %v", want, err)
+		}
+	}
+}
+
+func TestIsUnsorted(t *testing.T) {
+	oldDir := unsortedDirFlag
+	defer func() { unsortedDirFlag = oldDir }()
+
+	tests := []struct {
+		unsortedDir string
+		filename    string
+		want        bool
+	}{
+		{"/_unsorted", "/_unsorted/nodate/noexif.png", true},
+		{"/_unsorted/", "/_unsorted/nodate/noexif.png", true},
+		{"_unsorted", "/_unsorted/nodate/noexif.png", true},
+		{"_unsorted", "/_unsorted_old/noexif.png", false},
+		{"/_unsorted", "/noexif.png", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.unsortedDir+test.filename, func(t *testing.T) {
+			unsortedDirFlag = test.unsortedDir
+			if got := isUnsorted(test.filename); test.want != got {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckCancelled(t *testing.T) {
+	defer mockExiftool()()
+	unsortedFlag = true
+	defer func() { unsortedFlag = false }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	vfs.WriteFile(fs, "/noexif.png", []byte("File Type : PNG\n"), 0640)
+
+	// files whose metadata couldn't be read in time must not be treated as undated
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	jb := NewJob(fs, "/noexif.png", tempdir).(*job)
+	if err := jb.Check(ctx); err != context.Canceled {
+		t.Errorf("Wanted %v got %v", context.Canceled, err)
+	}
+}
+
+func TestSkipFlag(t *testing.T) {
+	skipFlag = true
+	defer func() { skipFlag = false }()
+
+	fs := vfs.NewOsFs("testdata")
+	defer fs.Close()
+	tests := []struct {
+		filename string
+		wantErr  error
+	}{
+		{"/noexif.png", errUnknownPattern},
+		{"/2010/01/2010_01_13_22:01:37_0000.jpg", errAlreadyProcessed},
+		{"/IMG_20130525_125511_332.jpg", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			jb := &job{fs: fs, root: "testdata/", filename: test.filename}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr != gotErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+
+	png := "\x89PNG\x0d\x0a\x1a\x0a\x00\x00\x00\x0dIHDR"
+	jpeg := "\xff\xd8\xff\xdb\x00\x84"
+	tests := []struct {
+		filename        string
+		content         string
+		fixExt          bool
+		wantNewFilename string
+	}{
+		{"/IMG_20130525_125511.JPEG", jpeg, false, "2013_05_25_12:55:11_0000.jpg"},
+		{"/VID_20130525_125512.qt", "", false, "2013_05_25_12:55:12_0000.mov"},
+		{"/IMG_20130525_125513.jpg", png, false, "2013_05_25_12:55:13_0000.jpg"},
+		{"/IMG_20130525_125514.jpg", png, true, "2013_05_25_12:55:14_0000.png"},
+		{"/IMG_20130525_125515.jpe", jpeg, true, "2013_05_25_12:55:15_0000.jpg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			fixExtFlag = test.fixExt
+			defer func() { fixExtFlag = false }()
+			vfs.WriteFile(fs, test.filename, []byte(test.content), 0640)
+
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			if err := jb.Check(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if test.wantNewFilename != jb.newFilename {
+				t.Errorf("Wanted newFilename %q got %q", test.wantNewFilename, jb.newFilename)
+			}
+		})
+	}
+}
+
+func TestWriteExif(t *testing.T) {
+	defer mockExiftool()()
+	writeExifFlag = true
+	defer func() { writeExifFlag = false }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+
+	tests := []struct {
+		filename     string
+		content      string
+		wantFilename string
+		wantTag      string
+	}{
+		{"/IMG_20130525_125511_332.jpg", "File Type : JPEG\nMIME Type : image/jpeg\n", "/2013/05/2013_05_25_12:55:11_0000.jpg", "DateTimeOriginal : 2013:05:25 12:55:11"},
+		{"/VID_20130525_125511_332.mp4", "File Type : MP4\nMIME Type : video/mp4\nCreate Date : 2012:01:01 00:00:00\n", "/2013/05/2013_05_25_12:55:11_0001.mp4", "QuickTime:CreateDate : 2013:05:25 12:55:11"},
+		{"/IMG_20130525_125512_332.jpg", "File Type : JPEG\nDate/Time Original : 2013:05:25 12:55:12\n", "/2013/05/2013_05_25_12:55:12_0000.jpg", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			vfs.WriteFile(fs, test.filename, []byte(test.content), 0640)
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			err := jb.Check(context.Background())
+			if err == nil {
+				err = jb.Execute(context.Background())
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if test.wantFilename != jb.filename {
+				t.Fatalf("Wanted filename %q got %q", test.wantFilename, jb.filename)
+			}
+
+			content, _ := vfs.ReadFile(fs, jb.filename)
+			_, err = fs.Stat(jb.filename + "_original")
+			if test.wantTag == "" {
+				if !vfs.IsNotExist(err) {
+					t.Errorf("Wanted no original file, got %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Wanted original file to be kept, got %v", err)
+				}
+
+				if !strings.Contains(string(content), test.wantTag) {
+					t.Errorf("Wanted %q to be written, got %q", test.wantTag, string(content))
+				}
+			}
+		})
+	}
+}
+
+func TestSameSecond(t *testing.T) {
+	defer mockExiftool()()
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+
+	// both files are checked before either is moved, as they are when jobs
+	// run concurrently, so both are first given the same name
+	jobs := []*job{}
+	for _, filename := range []string{"/IMG_20130525_125511_332.jpg", "/IMG_20130525_125511_333.jpg"} {
+		vfs.WriteFile(fs, filename, []byte("File Type : JPEG\n"+filename+"\n"), 0640)
+		jb := &job{fs: fs, root: tempdir, filename: filename}
+		if err := jb.Check(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		jobs = append(jobs, jb)
+	}
+
+	want := []string{"/2013/05/2013_05_25_12:55:11_0000.jpg", "/2013/05/2013_05_25_12:55:11_0001.jpg"}
+	for i, jb := range jobs {
+		original := jb.filename
+		if err := jb.Execute(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if want[i] != jb.filename {
+			t.Errorf("Wanted filename %q got %q", want[i], jb.filename)
+		}
+
+		if content, _ := vfs.ReadFile(fs, want[i]); !strings.Contains(string(content), original) {
+			t.Errorf("Wanted %q to hold %q, got %q", want[i], original, string(content))
+		}
+	}
+}
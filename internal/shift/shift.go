@@ -0,0 +1,248 @@
+// Package shift shifts the dates of files taken by cameras whose clock
+// was set wrong
+package shift
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/mh-orange/vfs"
+)
+
+var (
+	errNoFile      = errors.New("File removed prior to processing")
+	errIsDir       = errors.New("File is a directory")
+	errNotSelected = errors.New("File does not match the selection")
+	errNoDate      = errors.New("File has no known date")
+	errShifted     = errors.New("File has already been shifted")
+	errMotion      = errors.New("File is the motion half of a Live Photo and will be shifted with its still image")
+	errNoOffset    = errors.New("no offset given")
+
+	dirFlag     = ""
+	fromFlag    = ""
+	toFlag      = ""
+	modelFlag   = ""
+	yearsFlag   = 0
+	monthsFlag  = 0
+	daysFlag    = 0
+	offsetFlag  = time.Duration(0)
+	dryRunFlag  = false
+	shiftedLock sync.Mutex
+
+	// shifted holds the new names of files that have been shifted during this
+	// run so that they are not shifted a second time when the walk reaches
+	// the directory they were moved to
+	shifted = make(map[string]bool)
+)
+
+type job struct {
+	fs       vfs.FileSystem
+	root     string
+	filename string
+
+	date        time.Time
+	newDate     time.Time
+	newDir      string
+	newFilename string
+
+	// motion is the motion half of a Live Photo whose still image is the
+	// job's file, it is shifted and renamed along with the file
+	motion   []string
+	sidecars []string
+}
+
+func (jb *job) Name() string {
+	return jb.filename
+}
+
+// shift applies the offset given on the command line to t
+func shift(t time.Time) time.Time {
+	return t.AddDate(yearsFlag, monthsFlag, daysFlag).Add(offsetFlag)
+}
+
+// selected determines if the file matches the directory and filename
+// range selectors
+func selected(filename string) bool {
+	if dirFlag != "" {
+		dir := path.Clean("/" + dirFlag)
+		if dir != "/" && !strings.HasPrefix(filename, dir+"/") {
+			return false
+		}
+	}
+
+	base := path.Base(filename)
+	if fromFlag != "" && base < fromFlag {
+		return false
+	}
+
+	if toFlag != "" && base > toFlag {
+		return false
+	}
+	return true
+}
+
+func (jb *job) Check(ctx context.Context) error {
+	if fi, err := jb.fs.Stat(jb.filename); vfs.IsNotExist(err) {
+		return &mediacleaner.CheckError{Cause: errNoFile}
+	} else if err != nil {
+		return err
+	} else if fi.IsDir() {
+		return &mediacleaner.CheckError{Cause: errIsDir}
+	}
+
+	shiftedLock.Lock()
+	done := shifted[jb.filename]
+	shiftedLock.Unlock()
+	if done {
+		return &mediacleaner.CheckError{Cause: errShifted}
+	}
+
+	if mediacleaner.IsSidecar(jb.filename) || !selected(jb.filename) {
+		return &mediacleaner.CheckError{Cause: errNotSelected}
+	} else if mediacleaner.LivePhotoStill(jb.fs, jb.filename) != "" {
+		return &mediacleaner.CheckError{Cause: errMotion}
+	}
+
+	exif, err := mediacleaner.ReadExifContext(ctx, path.Join(jb.root, jb.filename))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return &mediacleaner.CheckError{Cause: err}
+	}
+
+	if modelFlag != "" {
+		if model, _ := exif.GetCamera(); !strings.EqualFold(model, modelFlag) {
+			return &mediacleaner.CheckError{Cause: errNotSelected}
+		}
+	}
+
+	jb.date, err = exif.GetDate()
+	if err != nil {
+		jb.date, err = mediacleaner.GetDateFromFilename(jb.filename)
+		if err != nil {
+			return &mediacleaner.CheckError{Cause: errNoDate}
+		}
+	}
+	jb.date = time.Date(jb.date.Year(), jb.date.Month(), jb.date.Day(), jb.date.Hour(), jb.date.Minute(), jb.date.Second(), 0, time.UTC)
+
+	jb.newDate = shift(jb.date)
+	jb.newDir = jb.newDate.Format("/2006/01")
+	err = jb.chooseName()
+	if err == nil {
+		jb.motion = livePhotoMotion(jb.fs, jb.filename)
+		jb.sidecars, err = mediacleaner.Sidecars(jb.fs, jb.filename)
+	}
+	return err
+}
+
+// livePhotoMotion finds the motion half of the Live Photo whose still
+// image is filename
+func livePhotoMotion(fs vfs.FileSystem, filename string) []string {
+	motion := []string{}
+	if !mediacleaner.LivePhotoStillExts[strings.ToLower(path.Ext(filename))] {
+		return motion
+	}
+
+	companions, _ := mediacleaner.Companions(fs, filename)
+	for _, companion := range companions {
+		if mediacleaner.IsLivePhotoPair(filename, companion) {
+			motion = append(motion, companion)
+		}
+	}
+	return motion
+}
+
+// chooseName sets the file's new name from its new date
+func (jb *job) chooseName() (err error) {
+	jb.newFilename, err = mediacleaner.GetPrefix(jb.fs, jb.newDir, jb.newDate.Format("2006_01_02_15:04:05"))
+	jb.newFilename = fmt.Sprintf("%s%s", jb.newFilename, strings.ToLower(path.Ext(jb.filename)))
+	return err
+}
+
+func (jb *job) Execute(ctx context.Context) error {
+	newFilename := path.Join(jb.newDir, jb.newFilename)
+	if dryRunFlag {
+		mediacleaner.Infof("Would shift %q from %s to %s and move it to %q", jb.filename, jb.date.Format("2006-01-02 15:04:05"), jb.newDate.Format("2006-01-02 15:04:05"), newFilename)
+		return nil
+	}
+
+	// both halves of a Live Photo are shifted so that they stay paired.
+	// exiftool's _original backup would be left behind when the file is moved
+	for _, filename := range append([]string{jb.filename}, jb.motion...) {
+		err := mediacleaner.WriteExifContext(ctx, path.Join(jb.root, filename), "-overwrite_original", fmt.Sprintf("-AllDates=%s", jb.newDate.Format("2006:01:02 15:04:05")))
+		if err != nil {
+			return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to write the dates of %q", filename), Cause: err}
+		}
+	}
+
+	// a concurrent job may have taken the name chosen by Check
+	mediacleaner.PrefixLock.Lock()
+	defer mediacleaner.PrefixLock.Unlock()
+	if err := jb.chooseName(); err != nil {
+		return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to choose a name in %q", jb.newDir), Cause: err}
+	}
+	newFilename = path.Join(jb.newDir, jb.newFilename)
+
+	err := vfs.MkdirAll(jb.fs, jb.newDir, 0750)
+	if err != nil {
+		return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed creating directory %q", jb.newDir), Cause: err}
+	}
+
+	oldStem := mediacleaner.Stem(jb.filename)
+	renames := [][2]string{{jb.filename, newFilename}}
+	for _, companion := range append(append([]string{}, jb.motion...), jb.sidecars...) {
+		suffix := strings.ToLower(strings.TrimPrefix(path.Base(companion), oldStem))
+		renames = append(renames, [2]string{companion, path.Join(jb.newDir, mediacleaner.Stem(jb.newFilename)+suffix)})
+	}
+
+	for _, rename := range renames {
+		err = jb.fs.Rename(rename[0], rename[1])
+		if err != nil {
+			return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to rename %q to %q", rename[0], rename[1]), Cause: err}
+		}
+		shiftedLock.Lock()
+		shifted[rename[1]] = true
+		shiftedLock.Unlock()
+	}
+	mediacleaner.Infof("Shifted %q to %q", jb.filename, newFilename)
+	jb.filename = newFilename
+	return nil
+}
+
+// RegisterFlags adds the date shifting options to the flag set
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&dirFlag, "dir", "", "dir - only shift files below this directory, relative to each root")
+	flags.StringVar(&fromFlag, "from", "", "from - only shift files whose name sorts at or after this name (e.g. DSC_0100.JPG)")
+	flags.StringVar(&toFlag, "to", "", "to - only shift files whose name sorts at or before this name (e.g. DSC_0250.JPG)")
+	flags.StringVar(&modelFlag, "model", "", "model - only shift files taken by this camera model (exif Camera Model Name)")
+	flags.IntVar(&yearsFlag, "years", 0, "years - number of years to shift the dates by")
+	flags.IntVar(&monthsFlag, "months", 0, "months - number of months to shift the dates by")
+	flags.IntVar(&daysFlag, "days", 0, "days - number of days to shift the dates by")
+	flags.DurationVar(&offsetFlag, "offset", 0, "offset - duration to shift the dates by (e.g. -1h30m)")
+	flags.BoolVar(&dryRunFlag, "n", false, "dry run - print what would be shifted without changing anything")
+}
+
+// Run shifts the dates of the files below the roots and returns the exit
+// code.  It fails straight away when no offset was given
+func Run(roots []string) int {
+	if yearsFlag == 0 && monthsFlag == 0 && daysFlag == 0 && offsetFlag == 0 {
+		mediacleaner.Errorf("%v", errNoOffset)
+		return 1
+	}
+
+	p := mediacleaner.Start(roots, NewJob)
+	p.Wait()
+	return p.ExitCode()
+}
+
+// NewJob creates the job that shifts the file's date
+func NewJob(fs vfs.FileSystem, filename string, root string) mediacleaner.ContextJob {
+	return &job{fs: fs, root: root, filename: filename}
+}
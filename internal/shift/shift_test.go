@@ -0,0 +1,214 @@
+package shift
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/abates/mediacleaner/internal/exiftooltest"
+	"github.com/mh-orange/vfs"
+)
+
+// mockExiftool sets up the fake exiftool so that it prints the media file
+// itself
+func mockExiftool() func() {
+	return exiftooltest.Mock(mediacleaner.CloseExifTool)
+}
+
+func TestFakeExifTool(t *testing.T) {
+	exiftooltest.Run()
+}
+
+func TestSelected(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		from     string
+		to       string
+		filename string
+		want     bool
+	}{
+		{"everything", "", "", "", "/vacation/DSC_0001.JPG", true},
+		{"in directory", "vacation", "", "", "/vacation/DSC_0001.JPG", true},
+		{"outside directory", "/vacation", "", "", "/work/DSC_0001.JPG", false},
+		{"in range", "", "DSC_0100.JPG", "DSC_0250.JPG", "/DSC_0100.JPG", true},
+		{"before range", "", "DSC_0100.JPG", "DSC_0250.JPG", "/DSC_0099.JPG", false},
+		{"after range", "", "DSC_0100.JPG", "DSC_0250.JPG", "/DSC_0251.JPG", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dirFlag, fromFlag, toFlag = test.dir, test.from, test.to
+			defer func() { dirFlag, fromFlag, toFlag = "", "", "" }()
+			got := selected(test.filename)
+			if test.want != got {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestShift(t *testing.T) {
+	yearsFlag, offsetFlag = 1, -time.Hour
+	defer func() { yearsFlag, offsetFlag = 0, 0 }()
+
+	want := time.Date(2019, 7, 14, 9, 0, 0, 0, time.UTC)
+	got := shift(time.Date(2018, 7, 14, 10, 0, 0, 0, time.UTC))
+	if !want.Equal(got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+}
+
+func TestJob(t *testing.T) {
+	defer mockExiftool()()
+	yearsFlag, offsetFlag, modelFlag = 1, -time.Hour, "Canon EOS 80D"
+	defer func() { yearsFlag, offsetFlag, modelFlag = 0, 0, "" }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	vfs.MkdirAll(fs, "/2018/07", 0750)
+	files := map[string]string{
+		"/2018/07/2018_07_14_10:00:00_0000.jpg": "Camera Model Name : Canon EOS 80D\nDate/Time Original : 2018:07:14 10:00:00\n",
+		"/2018/07/2018_07_14_10:00:00_0000.xmp": "",
+		"/2018/07/2018_07_14_10:00:00_0001.jpg": "Camera Model Name : Pixel 6 Pro\nDate/Time Original : 2018:07:14 10:00:00\n",
+	}
+	for filename, content := range files {
+		vfs.WriteFile(fs, filename, []byte(content), 0640)
+	}
+
+	tests := []struct {
+		filename     string
+		dryRun       bool
+		wantErr      error
+		wantFilename string
+	}{
+		{"/2018/07/2018_07_14_10:00:00_0001.jpg", false, errNotSelected, ""},
+		{"/2018/07/2018_07_14_10:00:00_0000.xmp", false, errNotSelected, ""},
+		{"/2018/07/2018_07_14_10:00:00_0000.jpg", true, nil, "/2018/07/2018_07_14_10:00:00_0000.jpg"},
+		{"/2018/07/2018_07_14_10:00:00_0000.jpg", false, nil, "/2019/07/2019_07_14_09:00:00_0000.jpg"},
+		{"/2019/07/2019_07_14_09:00:00_0000.jpg", false, errShifted, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			dryRunFlag = test.dryRun
+			defer func() { dryRunFlag = false }()
+
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr != gotErr {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+
+			if gotErr == nil {
+				if err := jb.Execute(context.Background()); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				if test.wantFilename != jb.filename {
+					t.Errorf("Wanted filename %q got %q", test.wantFilename, jb.filename)
+				}
+
+				content, _ := vfs.ReadFile(fs, jb.filename)
+				wantDate := "2018:07:14 10:00:00"
+				if !test.dryRun {
+					wantDate = "2019:07:14 09:00:00"
+					if _, err := fs.Stat("/2019/07/2019_07_14_09:00:00_0000.xmp"); err != nil {
+						t.Errorf("Wanted sidecar to be moved, got %v", err)
+					}
+
+					if _, err := fs.Stat(test.filename + "_original"); !vfs.IsNotExist(err) {
+						t.Errorf("Wanted no original file to be left, got %v", err)
+					}
+				}
+
+				if !strings.Contains(string(content), wantDate) {
+					t.Errorf("Wanted date %s in %q", wantDate, string(content))
+				}
+			}
+		})
+	}
+}
+
+func TestLivePhoto(t *testing.T) {
+	defer mockExiftool()()
+	yearsFlag, offsetFlag = 1, -time.Hour
+	defer func() { yearsFlag, offsetFlag = 0, 0 }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	vfs.MkdirAll(fs, "/2018/07", 0750)
+	for _, filename := range []string{"/2018/07/2018_07_14_10:00:00_0000.heic", "/2018/07/2018_07_14_10:00:00_0000.mov"} {
+		vfs.WriteFile(fs, filename, []byte("Date/Time Original : 2018:07:14 10:00:00\n"), 0640)
+	}
+
+	// the motion half is shifted with its still image
+	motion := &job{fs: fs, root: tempdir, filename: "/2018/07/2018_07_14_10:00:00_0000.mov"}
+	if err := motion.Check(context.Background()); !errors.Is(err, errMotion) {
+		t.Errorf("Wanted error %v got %v", errMotion, err)
+	}
+
+	still := &job{fs: fs, root: tempdir, filename: "/2018/07/2018_07_14_10:00:00_0000.heic"}
+	err := still.Check(context.Background())
+	if err == nil {
+		err = still.Execute(context.Background())
+	}
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, filename := range []string{"/2019/07/2019_07_14_09:00:00_0000.heic", "/2019/07/2019_07_14_09:00:00_0000.mov"} {
+		content, err := vfs.ReadFile(fs, filename)
+		if err != nil {
+			t.Errorf("Wanted %q to exist, got %v", filename, err)
+		} else if !strings.Contains(string(content), "2019:07:14 09:00:00") {
+			t.Errorf("Wanted %q to be shifted, got %q", filename, string(content))
+		}
+	}
+}
+
+func TestExecuteCancelled(t *testing.T) {
+	defer mockExiftool()()
+	yearsFlag = 1
+	defer func() { yearsFlag = 0 }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	vfs.MkdirAll(fs, "/2018/07", 0750)
+	filename := "/2018/07/2018_07_14_10:00:00_0000.jpg"
+	vfs.WriteFile(fs, filename, []byte("Date/Time Original : 2018:07:14 10:00:00\n"), 0640)
+
+	jb := &job{fs: fs, root: tempdir, filename: filename}
+	if err := jb.Check(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := jb.Execute(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted %v got %v", context.Canceled, err)
+	}
+
+	if _, err := fs.Stat(filename); err != nil {
+		t.Errorf("Wanted the file to be left in place, got %v", err)
+	}
+}
+
+func TestRunNoOffset(t *testing.T) {
+	if got := Run([]string{os.TempDir()}); got != 1 {
+		t.Errorf("Wanted exit code 1 without an offset, got %d", got)
+	}
+}
@@ -0,0 +1,274 @@
+// Package thumbs generates thumbnails of images and videos
+package thumbs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/abates/mediacleaner/internal/ffmpeg"
+	"github.com/mh-orange/vfs"
+)
+
+var (
+	errNoFile     = errors.New("File removed prior to processing")
+	errNotRenamed = errors.New("will only generate thumbnails for files that have been named correctly (/YYYY/MM/YYYY_MM_DD_HH:MM:SS_xxxx.ext)")
+	errNotMedia   = errors.New("file doesn't appear to be an image or video file")
+	errUpToDate   = errors.New("thumbnails are newer than the file")
+
+	sizesFlag    = sizeList{256}
+	formatFlag   = "jpeg"
+	qualityFlag  = 85
+	thumbDirFlag = "/.thumbnails"
+	posterFlag   = 10
+)
+
+// ExecuteTimeout is the default limit on creating a file's thumbnails
+const ExecuteTimeout = 5 * time.Minute
+
+// sizeList is a flag.Value holding a comma separated list of thumbnail sizes
+type sizeList []int
+
+func (sl *sizeList) String() string {
+	sizes := []string{}
+	for _, size := range *sl {
+		sizes = append(sizes, strconv.Itoa(size))
+	}
+	return strings.Join(sizes, ",")
+}
+
+func (sl *sizeList) Set(str string) error {
+	sizes := sizeList{}
+	for _, token := range strings.Split(str, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(token))
+		if err != nil || size < 1 {
+			return fmt.Errorf("invalid thumbnail size %q", token)
+		}
+		sizes = append(sizes, size)
+	}
+	*sl = sizes
+	return nil
+}
+
+type job struct {
+	fs       vfs.FileSystem
+	root     string
+	filename string
+	video    bool
+
+	// outputs maps thumbnail sizes to the thumbnail filenames
+	// that need to be (re)generated
+	outputs map[int]string
+}
+
+func (jb *job) Name() string {
+	return jb.filename
+}
+
+// TimeLimits keeps the ExecuteTimeout limit when -execute-timeout is zero,
+// as it is when thumbs runs as a stage of a pipeline
+func (jb *job) TimeLimits() (check, execute time.Duration) {
+	if mediacleaner.ExecuteTimeout > 0 {
+		return mediacleaner.CheckTimeout, mediacleaner.ExecuteTimeout
+	}
+	return mediacleaner.CheckTimeout, ExecuteTimeout
+}
+
+func thumbExt() string {
+	if formatFlag == "webp" {
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+// thumbFilename returns the name of the thumbnail for the given size.  The
+// thumbnail tree mirrors the /YYYY/MM/ layout of the media files.  The
+// file's extension is kept so that the halves of a Live Photo, or a file
+// and its converted copy, don't share a thumbnail
+func thumbFilename(filename string, size int) string {
+	return path.Join(thumbDirFlag, strconv.Itoa(size), path.Dir(filename), path.Base(filename)+thumbExt())
+}
+
+func (jb *job) Check(ctx context.Context) error {
+	fi, err := jb.fs.Stat(jb.filename)
+	if vfs.IsNotExist(err) {
+		return &mediacleaner.CheckError{Cause: errNoFile}
+	} else if err != nil {
+		return err
+	}
+
+	// only generate thumbnails for files that have already been named correctly
+	dir := []byte(path.Dir(jb.filename))
+	if mediacleaner.YearMonthDir.Match(dir) || mediacleaner.YearMonthDayDir.Match(dir) {
+		fn := []byte(path.Base(jb.filename))
+		if !mediacleaner.FilePrefix.Match(fn) {
+			return &mediacleaner.CheckError{Cause: errNotRenamed}
+		}
+	} else {
+		return &mediacleaner.CheckError{Cause: errNotRenamed}
+	}
+
+	jb.outputs = make(map[int]string)
+	for _, size := range sizesFlag {
+		output := thumbFilename(jb.filename, size)
+		if thumb, err := jb.fs.Stat(output); err == nil && !thumb.ModTime().Before(fi.ModTime()) {
+			continue
+		}
+		jb.outputs[size] = output
+	}
+
+	if len(jb.outputs) == 0 {
+		return &mediacleaner.CheckError{Cause: errUpToDate}
+	}
+
+	if jb.isImage() {
+		return nil
+	}
+
+	if ok, err := ffmpeg.IsVideo(ctx, path.Join(jb.root, jb.filename)); ctx.Err() != nil {
+		return err
+	} else if ok {
+		jb.video = true
+		return nil
+	}
+	return &mediacleaner.CheckError{Cause: errNotMedia}
+}
+
+// isImage determines if the file is an image that can be decoded
+func (jb *job) isImage() bool {
+	file, err := jb.fs.Open(jb.filename)
+	if err != nil {
+		return false
+	}
+	_, _, err = image.DecodeConfig(file)
+	if closer, ok := file.(io.Closer); ok {
+		closer.Close()
+	}
+	return err == nil
+}
+
+// posterFrame extracts a single frame from a video
+func (jb *job) posterFrame(ctx context.Context) (image.Image, error) {
+	filename := path.Join(jb.root, jb.filename)
+	info, err := ffmpeg.Probe(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	start := info.Duration() * time.Duration(posterFlag) / 100
+	proc, err := ffmpeg.Transcode(ctx, nil, buf, "-ss", fmt.Sprintf("%f", start.Seconds()), "-i", filename, "-lavfi", "trim=end_frame=1", "-f", "image2pipe", "-")
+	if err == nil {
+		err = proc.Wait()
+	}
+
+	if err == nil {
+		var img image.Image
+		img, _, err = image.Decode(buf)
+		return img, err
+	}
+	return nil, err
+}
+
+func (jb *job) load(ctx context.Context) (image.Image, error) {
+	if jb.video {
+		return jb.posterFrame(ctx)
+	}
+
+	data, err := vfs.ReadFile(jb.fs, jb.filename)
+	if err == nil {
+		var img image.Image
+		img, _, err = image.Decode(bytes.NewReader(data))
+		return img, err
+	}
+	return nil, err
+}
+
+func encode(ctx context.Context, img image.Image) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if formatFlag != "webp" {
+		err := jpeg.Encode(buf, img, &jpeg.Options{Quality: qualityFlag})
+		return buf.Bytes(), err
+	}
+
+	// there is no pure Go webp encoder, so hand a lossless
+	// copy of the thumbnail to ffmpeg for encoding
+	err := png.Encode(buf, img)
+	if err == nil {
+		output := &bytes.Buffer{}
+		var proc *ffmpeg.Job
+		proc, err = ffmpeg.Transcode(ctx, buf, output, "-i", "-", "-f", "webp", "-")
+		if err == nil {
+			err = proc.Wait()
+		}
+		return output.Bytes(), err
+	}
+	return nil, err
+}
+
+func (jb *job) Execute(ctx context.Context) error {
+	img, err := jb.load(ctx)
+	if err != nil {
+		return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to read %q", jb.filename), Cause: err}
+	}
+
+	for _, size := range sizesFlag {
+		output, found := jb.outputs[size]
+		if !found {
+			continue
+		}
+
+		err = vfs.MkdirAll(jb.fs, path.Dir(output), 0750)
+		if err != nil {
+			return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed creating directory %q", path.Dir(output)), Cause: err}
+		}
+
+		var data []byte
+		data, err = encode(ctx, scale(img, size))
+		if err == nil {
+			err = vfs.WriteFile(jb.fs, output, data, 0640)
+		}
+
+		if err != nil {
+			return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to create thumbnail %q", output), Cause: err}
+		}
+		mediacleaner.Infof("Created thumbnail %q", output)
+	}
+	return nil
+}
+
+// RegisterFlags adds the thumbnail options to the flag set
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.Var(&sizesFlag, "sizes", "sizes - comma separated list of thumbnail sizes (longest side in pixels)")
+	flags.StringVar(&formatFlag, "format", formatFlag, "format - thumbnail format (jpeg or webp)")
+	flags.IntVar(&qualityFlag, "quality", qualityFlag, "quality - jpeg thumbnail quality (1-100)")
+	flags.StringVar(&thumbDirFlag, "thumbdir", thumbDirFlag, "thumbdir - directory, relative to each root, where thumbnails are written")
+	flags.IntVar(&posterFlag, "poster", posterFlag, "poster - position of the video poster frame as a percentage of the duration")
+}
+
+// isThumbnail determines if the file is in the thumbnail tree
+func isThumbnail(filename string) bool {
+	dir := path.Clean("/" + thumbDirFlag)
+	return filename == dir || strings.HasPrefix(filename, dir+"/")
+}
+
+// NewJob creates the job that generates the file's thumbnails, the
+// thumbnails themselves are ignored
+func NewJob(fs vfs.FileSystem, filename string, root string) mediacleaner.ContextJob {
+	if isThumbnail(filename) {
+		return nil
+	}
+	return &job{fs: fs, root: root, filename: filename}
+}
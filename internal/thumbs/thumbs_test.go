@@ -0,0 +1,295 @@
+package thumbs
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/abates/mediacleaner/internal/ffmpeg"
+	"github.com/mh-orange/cmd"
+	"github.com/mh-orange/vfs"
+)
+
+func readFile(t *testing.T, filename, ext string) []byte {
+	for ext := filepath.Ext(filename); len(ext) > 0; ext = filepath.Ext(filename) {
+		filename = filename[0 : len(filename)-len(ext)]
+	}
+
+	content := []byte{}
+	filename = fmt.Sprintf("testdata%s.%s", filename, ext)
+	if _, err := os.Stat(filename); err == nil {
+		content, err = ioutil.ReadFile(filename)
+		if err != nil {
+			t.Logf("Failed to read file %q: %v", filename, err)
+		}
+	}
+
+	return content
+}
+
+func mockCmd(t *testing.T, input string) func() {
+	oldFfprobe := ffmpeg.Ffprobe
+	oldFfmpeg := ffmpeg.Ffmpeg
+
+	ffmpeg.Ffmpeg = &cmd.TestCmd{
+		Stdout: readFile(t, input, "ffmpeg"),
+		Stderr: readFile(t, input, "ffmpeg_err"),
+	}
+
+	ffmpeg.Ffprobe = &cmd.TestCmd{
+		Stdout: readFile(t, input, "ffprobe"),
+		Stderr: readFile(t, input, "ffprobe_err"),
+	}
+
+	return func() {
+		ffmpeg.Ffmpeg = oldFfmpeg
+		ffmpeg.Ffprobe = oldFfprobe
+	}
+}
+
+func copyTestdata(t *testing.T) (vfs.FileSystem, string) {
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	fs := vfs.NewOsFs(tempdir)
+	filepath.Walk("testdata", func(inpath string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			outpath := strings.TrimPrefix(inpath, "testdata")
+			vfs.MkdirAll(fs, filepath.Dir(outpath), 0750)
+			in, _ := os.Open(inpath)
+			out, err := fs.Create(outpath)
+			if err == nil {
+				io.Copy(out, in)
+				in.Close()
+				if closer, ok := out.(io.Closer); ok {
+					closer.Close()
+				}
+			} else {
+				t.Fatalf("Failed to copy %q: %v", inpath, err)
+			}
+		}
+		return err
+	})
+	return fs, tempdir
+}
+
+func TestSizeList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"256", "256", false},
+		{"128, 512", "128,512", false},
+		{"128,foo", "", true},
+		{"0", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got := sizeList{}
+			gotErr := got.Set(test.input)
+			if test.wantErr {
+				if gotErr == nil {
+					t.Errorf("Wanted error got nil")
+				}
+			} else if test.want != got.String() {
+				t.Errorf("Wanted %q got %q", test.want, got.String())
+			}
+		})
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name  string
+		input image.Rectangle
+		size  int
+		want  image.Rectangle
+	}{
+		{"landscape", image.Rect(0, 0, 400, 200), 100, image.Rect(0, 0, 100, 50)},
+		{"portrait", image.Rect(0, 0, 200, 400), 100, image.Rect(0, 0, 50, 100)},
+		{"offset", image.Rect(10, 10, 410, 210), 100, image.Rect(0, 0, 100, 50)},
+		{"small", image.Rect(0, 0, 50, 20), 100, image.Rect(0, 0, 50, 20)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := scale(image.NewRGBA(test.input), test.size).Bounds()
+			if test.want != got {
+				t.Errorf("Wanted bounds %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestThumbFilename(t *testing.T) {
+	oldFormat := formatFlag
+	defer func() { formatFlag = oldFormat }()
+
+	tests := []struct {
+		format   string
+		filename string
+		want     string
+	}{
+		{"jpeg", "/2010/01/2010_01_01_00:00:00_0003.mpg", "/.thumbnails/256/2010/01/2010_01_01_00:00:00_0003.mpg.jpg"},
+		{"webp", "/2010/01/2010_01_01_00:00:00_0003.mpg", "/.thumbnails/256/2010/01/2010_01_01_00:00:00_0003.mpg.webp"},
+		{"jpeg", "/2010/01/2010_01_01_00:00:00_0001.heic", "/.thumbnails/256/2010/01/2010_01_01_00:00:00_0001.heic.jpg"},
+		{"jpeg", "/2010/01/2010_01_01_00:00:00_0001.mov", "/.thumbnails/256/2010/01/2010_01_01_00:00:00_0001.mov.jpg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format+test.filename, func(t *testing.T) {
+			formatFlag = test.format
+			got := thumbFilename(test.filename, 256)
+			if test.want != got {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestNewJob(t *testing.T) {
+	oldDir := thumbDirFlag
+	defer func() { thumbDirFlag = oldDir }()
+
+	tests := []struct {
+		thumbDir string
+		filename string
+		want     bool
+	}{
+		{"/.thumbnails", "/2010/01/2010_01_01_00:00:00_0003.jpg", true},
+		{"/.thumbnails", "/.thumbnails/256/2010/01/2010_01_01_00:00:00_0003.jpg", false},
+		{"/.thumbnails", "/.thumbnails.jpg", true},
+		{"thumbs/", "/thumbs/256/2010/01/2010_01_01_00:00:00_0003.jpg", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			thumbDirFlag = test.thumbDir
+			if got := NewJob(nil, test.filename, "/") != nil; test.want != got {
+				t.Errorf("Wanted a job %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestJobCheck(t *testing.T) {
+	fs, tempdir := copyTestdata(t)
+	defer os.RemoveAll(tempdir)
+
+	// an up to date thumbnail
+	vfs.MkdirAll(fs, "/.thumbnails/256/2010/01", 0750)
+	vfs.WriteFile(fs, "/.thumbnails/256/2010/01/2010_01_01_00:00:00_0004.jpg.jpg", nil, 0640)
+	vfs.WriteFile(fs, "/2010/01/2010_01_01_00:00:00_0004.jpg", nil, 0640)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(tempdir, "/2010/01/2010_01_01_00:00:00_0004.jpg"), past, past)
+	vfs.WriteFile(fs, "/2010/01/2010_01_01_00:00:00_0005.txt", []byte("hello world"), 0640)
+
+	tests := []struct {
+		filename  string
+		wantVideo bool
+		wantErr   error
+	}{
+		{"/2010/01/2010_01_01_00:00:00_0001.jpg", false, errNoFile},
+		{"/2010_01_01_00:00:00_0002.jpg", false, errNoFile},
+		{"/2010/01/2010_01_01_00:00:00_0002.jpg", false, nil},
+		{"/2010/01/2010_01_01_00:00:00_0003.mpg", true, nil},
+		{"/2010/01/2010_01_01_00:00:00_0004.jpg", false, errUpToDate},
+		{"/2010/01/2010_01_01_00:00:00_0005.txt", false, errNotMedia},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			defer mockCmd(t, test.filename)()
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr == gotErr {
+				if gotErr == nil && test.wantVideo != jb.video {
+					t.Errorf("Wanted video %v got %v", test.wantVideo, jb.video)
+				}
+			} else {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestJobExecute(t *testing.T) {
+	fs, tempdir := copyTestdata(t)
+	defer os.RemoveAll(tempdir)
+	mediacleaner.QuietFlag = true
+	defer func() { mediacleaner.QuietFlag = false }()
+
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"/2010/01/2010_01_01_00:00:00_0002.jpg", "/.thumbnails/64/2010/01/2010_01_01_00:00:00_0002.jpg.jpg"},
+		{"/2010/01/2010_01_01_00:00:00_0003.mpg", "/.thumbnails/64/2010/01/2010_01_01_00:00:00_0003.mpg.jpg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			defer mockCmd(t, test.filename)()
+			jb := &job{fs: fs, root: tempdir, filename: test.filename}
+			jb.video = filepath.Ext(test.filename) == ".mpg"
+			jb.outputs = map[int]string{64: test.want}
+			oldSizes := sizesFlag
+			sizesFlag = sizeList{64}
+			defer func() { sizesFlag = oldSizes }()
+
+			err := jb.Execute(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			file, err := fs.Open(test.want)
+			if err != nil {
+				t.Fatalf("Wanted thumbnail to exist, got %v", err)
+			}
+
+			config, _, err := image.DecodeConfig(file)
+			if err != nil {
+				t.Fatalf("Failed to decode thumbnail: %v", err)
+			}
+
+			if config.Width > 64 || config.Height > 64 {
+				t.Errorf("Wanted thumbnail no larger than 64x64 got %dx%d", config.Width, config.Height)
+			}
+		})
+	}
+}
+
+func TestJobTimeLimits(t *testing.T) {
+	oldTimeout := mediacleaner.ExecuteTimeout
+	defer func() { mediacleaner.ExecuteTimeout = oldTimeout }()
+
+	tests := []struct {
+		name           string
+		executeTimeout time.Duration
+		want           time.Duration
+	}{
+		{"pipeline stage", 0, ExecuteTimeout},
+		{"execute-timeout", time.Hour, time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mediacleaner.ExecuteTimeout = test.executeTimeout
+			if _, got := (&job{}).TimeLimits(); test.want != got {
+				t.Errorf("Wanted execute limit %v got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package transcode
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/abates/mediacleaner/internal/ffmpeg"
+)
+
+// priorityArgs returns the command line that runs ffmpeg with the
+// scheduling priority and I/O class
+func priorityArgs(nice, ioclass int) ([]string, error) {
+	args := []string{}
+	if ioclass != 0 {
+		if ioclass < 1 || ioclass > 3 {
+			return nil, fmt.Errorf("invalid ionice class %d, must be 1, 2 or 3", ioclass)
+		}
+		args = append(args, "ionice", "-c", strconv.Itoa(ioclass))
+		if ioclass == 2 {
+			// best-effort defaults to the middle of the priority range
+			args = append(args, "-n", "4")
+		}
+	}
+
+	if nice != 0 {
+		args = append(args, "nice", "-n", strconv.Itoa(nice))
+	}
+	return args, nil
+}
+
+// setPriority runs ffmpeg with nice and ionice so that the transcodes, and
+// not the rest of the process, get the scheduling and I/O priority
+func setPriority(nice, ioclass int) error {
+	if nice == 0 && ioclass == 0 {
+		return nil
+	}
+
+	args, err := priorityArgs(nice, ioclass)
+	if err == nil {
+		ffmpeg.Prefix(args...)
+	}
+	return err
+}
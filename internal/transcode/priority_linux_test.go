@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package transcode
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abates/mediacleaner/internal/ffmpeg"
+)
+
+func TestPriorityArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		nice    int
+		ioclass int
+		want    string
+		wantErr bool
+	}{
+		{"nice", 10, 0, "nice -n 10", false},
+		{"idle", 0, 3, "ionice -c 3", false},
+		{"both", 19, 2, "ionice -c 2 -n 4 nice -n 19", false},
+		{"bad class", 0, 4, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := priorityArgs(test.nice, test.ioclass)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			} else if err != nil {
+				return
+			}
+
+			want := strings.Fields(test.want)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("Wanted %v got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestSetupThreadsAndNice(t *testing.T) {
+	oldFfmpeg := ffmpeg.Ffmpeg
+	oldThreads, oldNice := threadsFlag, niceFlag
+	defer func() {
+		ffmpeg.Ffmpeg = oldFfmpeg
+		ffmpeg.Ffmpeg.SetPath("ffmpeg")
+		ffmpeg.Prefix()
+		threadsFlag, niceFlag = oldThreads, oldNice
+	}()
+
+	// true ignores its arguments, so the command line can be checked by
+	// running it in place of ffmpeg
+	ffmpeg.Ffmpeg.SetPath("true")
+	threadsFlag, niceFlag = 2, 10
+	setup()
+
+	proc := ffmpeg.Ffmpeg.Process()
+	proc.AppendArgs("-i", "in.mpg", "-y", "out.mp4")
+	if err := proc.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := proc.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tp, ok := proc.(*threadsProcess)
+	if !ok {
+		t.Fatalf("Wanted the threads to be kept, got %T", proc)
+	}
+
+	// once started, the process repeats the appended arguments in its string
+	want := "nice -n 10 true -hide_banner -nostdin -nostats -progress pipe:2 -i in.mpg -threads 2 -y out.mp4"
+	if got := fmt.Sprint(tp.Process); !strings.HasPrefix(got, want+" ") {
+		t.Errorf("Wanted %q got %q", want, got)
+	}
+}
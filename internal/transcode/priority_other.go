@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package transcode
+
+import "errors"
+
+func setPriority(nice, ioclass int) error {
+	if nice != 0 || ioclass != 0 {
+		return errors.New("process priority is only supported on linux")
+	}
+	return nil
+}
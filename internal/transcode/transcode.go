@@ -0,0 +1,211 @@
+// Package transcode converts videos to mp4 files that can be played
+// pretty much anywhere
+package transcode
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/abates/mediacleaner"
+	"github.com/abates/mediacleaner/internal/ffmpeg"
+	"github.com/mh-orange/cmd"
+	"github.com/mh-orange/vfs"
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+var (
+	errAlreadyMp4 = errors.New("file is already an mp4 file")
+	errNotVideo   = errors.New("file doesn't appear to be a video file")
+	errNotRenamed = errors.New("will only transcode files that have been named correctly (/YYYY/MM/YYYY_MM_DD_HH:MM:SS_xxxx.ext)")
+	errLivePhoto  = errors.New("file is the motion half of a Live Photo")
+
+	threadsFlag = 0
+	niceFlag    = 0
+	ioniceFlag  = 0
+	windowFlag  = mediacleaner.TimeWindow{}
+	liveFlag    = "transcode"
+
+	setupOnce sync.Once
+)
+
+// threadsCommand wraps the ffmpeg command so that every process
+// it creates is limited to a number of threads
+type threadsCommand struct {
+	cmd.Command
+	threads int
+}
+
+func (tc *threadsCommand) Process() cmd.Process {
+	return &threadsProcess{Process: tc.Command.Process(), threads: strconv.Itoa(tc.threads)}
+}
+
+// threadsProcess holds on to the arguments until the process is started so
+// that the -threads option can be placed with the output options
+type threadsProcess struct {
+	cmd.Process
+	threads string
+	args    []string
+}
+
+func (tp *threadsProcess) Args() []string { return tp.args }
+
+func (tp *threadsProcess) AppendArgs(args ...string) {
+	tp.args = append(tp.args, args...)
+}
+
+func (tp *threadsProcess) Start() error {
+	args := tp.args
+	i := len(args)
+	for j := len(args) - 1; j >= 0; j-- {
+		if args[j] == "-y" || args[j] == "-" {
+			i = j
+			break
+		}
+	}
+	args = append(append(append([]string{}, args[:i]...), "-threads", tp.threads), args[i:]...)
+	tp.Process.AppendArgs(args...)
+	return tp.Process.Start()
+}
+
+// setup applies the process wide settings from the command line flags.  It
+// must run after the flags have been parsed
+func setup() {
+	if threadsFlag > 0 {
+		ffmpeg.Wrap(func(command cmd.Command) cmd.Command {
+			return &threadsCommand{Command: command, threads: threadsFlag}
+		})
+	}
+
+	if err := setPriority(niceFlag, ioniceFlag); err != nil {
+		mediacleaner.Errorf("%v", err)
+	}
+}
+
+type job struct {
+	fs       vfs.FileSystem
+	root     string
+	filename string
+
+	// output is the mp4 once the file has been transcoded
+	output string
+}
+
+func (jb *job) Name() string {
+	return jb.filename
+}
+
+// Moved returns the name of the mp4 that replaced the file
+func (jb *job) Moved() string {
+	if jb.output != "" {
+		return jb.output
+	}
+	return jb.filename
+}
+
+func (jb *job) Check(ctx context.Context) error {
+	// only convert files that have already been named correctly
+	dir := []byte(path.Dir(jb.filename))
+	if mediacleaner.YearMonthDir.Match(dir) || mediacleaner.YearMonthDayDir.Match(dir) {
+		fn := []byte(path.Base(jb.filename))
+		if !mediacleaner.FilePrefix.Match(fn) {
+			return &mediacleaner.CheckError{Cause: errNotRenamed}
+		}
+	} else {
+		return &mediacleaner.CheckError{Cause: errNotRenamed}
+	}
+
+	// convert video files to mp4's that can be pretty much played anywhere
+	if path.Ext(jb.filename) == ".mp4" {
+		return &mediacleaner.CheckError{Cause: errAlreadyMp4}
+	}
+	if liveFlag == "skip" && mediacleaner.LivePhotoStill(jb.fs, jb.filename) != "" {
+		return &mediacleaner.CheckError{Cause: errLivePhoto}
+	}
+
+	if ok, err := ffmpeg.IsVideo(ctx, path.Join(jb.root, jb.filename)); ctx.Err() != nil {
+		return err
+	} else if !ok {
+		return &mediacleaner.CheckError{Cause: errNotVideo}
+	}
+	return nil
+}
+
+// wait waits for the transcode to finish, showing its progress
+func wait(proc *ffmpeg.Job) error {
+	// progress bars from concurrent transcodes would overwrite each other
+	if !mediacleaner.QuietFlag && mediacleaner.Concurrency <= 1 {
+		bar := pb.New(0)
+		bar.Output = mediacleaner.Output
+		for info := range proc.Progress() {
+			if bar.Total == 0 {
+				bar.Total = int64(info.Duration)
+				bar = bar.Start()
+			}
+			bar.Set64(int64(info.Time))
+		}
+		bar.Set64(bar.Total)
+		bar.Finish()
+	}
+
+	return proc.Wait()
+}
+
+func (jb *job) Execute(ctx context.Context) error {
+	setupOnce.Do(setup)
+	// other files are transcoded, or checked, while this one waits
+	if err := mediacleaner.Idle(ctx, windowFlag.WaitContext); err != nil {
+		return &mediacleaner.ExecuteError{Msg: fmt.Sprintf("gave up waiting to transcode %q", jb.filename), Cause: err}
+	}
+
+	input := path.Join(jb.root, jb.filename)
+	if !mediacleaner.QuietFlag {
+		mediacleaner.Infof("Transcoding %q", jb.filename)
+	}
+	outputName := fmt.Sprintf("%s.mp4", jb.filename[0:len(jb.filename)-len(path.Ext(jb.filename))])
+	output := path.Join(jb.root, outputName)
+	_, statErr := jb.fs.Stat(outputName)
+	existed := statErr == nil
+
+	proc, err := ffmpeg.Transcode(ctx, nil, nil, "-i", input, "-c:v", "libx264", "-preset", "medium", "-tune", "film", "-pix_fmt", "yuv420p", "-c:a", "aac", "-y", output)
+	if err == nil {
+		err = wait(proc)
+	}
+
+	if err != nil && !existed {
+		// don't leave a partial mp4 behind
+		if rmErr := jb.fs.Remove(outputName); rmErr != nil && !vfs.IsNotExist(rmErr) {
+			mediacleaner.Errorf("Failed to remove partial output %q: %v", outputName, rmErr)
+		}
+	}
+
+	if err == nil {
+		jb.output = outputName
+		err = jb.fs.Remove(jb.filename)
+		if err != nil {
+			err = &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to remove %q", jb.filename), Cause: err}
+		}
+	} else {
+		err = &mediacleaner.ExecuteError{Msg: fmt.Sprintf("failed to transcode %q", jb.filename), Cause: err}
+	}
+	return err
+}
+
+// RegisterFlags adds the transcoder's options to the flag set
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.IntVar(&threadsFlag, "threads", 0, "threads - number of threads each ffmpeg process may use (0 lets ffmpeg decide)")
+	flags.IntVar(&mediacleaner.Concurrency, "max-concurrent-transcodes", 1, "max-concurrent-transcodes - number of ffmpeg processes to run at the same time")
+	flags.IntVar(&niceFlag, "nice", 0, "nice - scheduling priority adjustment for ffmpeg (-20 to 19)")
+	flags.IntVar(&ioniceFlag, "ionice", 0, "ionice - I/O scheduling class for ffmpeg (1 realtime, 2 best-effort, 3 idle)")
+	flags.StringVar(&liveFlag, "live-photos", liveFlag, "live-photos - how to handle the motion half of Live Photos (transcode or skip)")
+	flags.Var(&windowFlag, "window", "window - only transcode during this time of day (HH:MM-HH:MM), files found outside the window are queued until it opens")
+}
+
+// NewJob creates the job that transcodes the file
+func NewJob(fs vfs.FileSystem, filename string, root string) mediacleaner.ContextJob {
+	return &job{fs: fs, root: root, filename: filename}
+}
@@ -0,0 +1,327 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abates/mediacleaner"
+	"github.com/abates/mediacleaner/internal/ffmpeg"
+	"github.com/mh-orange/cmd"
+	"github.com/mh-orange/vfs"
+)
+
+func readFile(t *testing.T, filename, ext string) []byte {
+	for ext := filepath.Ext(filename); len(ext) > 0; ext = filepath.Ext(filename) {
+		filename = filename[0 : len(filename)-len(ext)]
+	}
+
+	content := []byte{}
+	filename = fmt.Sprintf("testdata%s.%s", filename, ext)
+	if _, err := os.Stat(filename); err == nil {
+		content, err = ioutil.ReadFile(filename)
+		if err != nil {
+			t.Logf("Failed to read file %q: %v", filename, err)
+		}
+	}
+
+	return content
+}
+
+func mockCmd(t *testing.T, input string) func() {
+	oldFfprobe := ffmpeg.Ffprobe
+	oldFfmpeg := ffmpeg.Ffmpeg
+
+	ffm := &cmd.TestCmd{
+		Stdout: readFile(t, input, "ffmpeg"),
+		Stderr: readFile(t, input, "ffmpeg_err"),
+	}
+
+	ffp := &cmd.TestCmd{
+		Stdout: readFile(t, input, "ffprobe"),
+		Stderr: readFile(t, input, "ffprobe_err"),
+	}
+
+	ffmpeg.Ffmpeg = ffm
+	ffmpeg.Ffprobe = ffp
+
+	return func() {
+		ffmpeg.Ffmpeg = oldFfmpeg
+		ffmpeg.Ffprobe = oldFfprobe
+	}
+}
+
+func TestJobCheck(t *testing.T) {
+	fs := vfs.NewOsFs("testdata")
+	defer fs.Close()
+	tests := []struct {
+		filename string
+		wantErr  error
+	}{
+		{"/2010_01_01_00:00:00_0001.mov", errNotRenamed},
+		{"/2010/2010_01_01_00:00:00_0001.mov", errNotRenamed},
+		{"/2010/01/2010_01_01_00:00:00_0001.mp4", errAlreadyMp4},
+		{"/2010/01/2010_01_01_00:00:00_0002.jpg", errNotVideo},
+		{"/2010/01/2010_01_01_00:00:00_0003.mpg", nil},
+		{"/2010/01/foo.mpg", errNotRenamed},
+		{"/2010/01/01/2010_01_01_00:00:00_0003.mpg", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			defer mockCmd(t, test.filename)()
+			jb := &job{fs: fs, root: "testdata/", filename: test.filename}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr == gotErr {
+				if gotErr == nil {
+				}
+			} else {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestJobExecute(t *testing.T) {
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+	defer fs.Close()
+
+	filepath.Walk("testdata", func(inpath string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			outpath := strings.TrimPrefix(inpath, "testdata")
+			vfs.MkdirAll(fs, filepath.Dir(outpath), 0750)
+			in, _ := os.Open(inpath)
+			out, err := fs.Create(outpath)
+			if err == nil {
+				io.Copy(out, in)
+				in.Close()
+				if closer, ok := out.(io.Closer); ok {
+					closer.Close()
+				}
+			} else {
+				panic(err.Error())
+			}
+		}
+		return err
+	})
+
+	tests := []struct {
+		filename string
+		wantLog  string
+		wantErr  string
+	}{
+		{"/2010/01/2010_01_01_00:00:00_0003.mpg", "Transcoding \"/2010/01/2010_01_01_00:00:00_0003.mpg\"\n", ""},
+		{"/2010/01/2010_01_01_00:00:00_0004.txt.gz", "Transcoding \"/2010/01/2010_01_01_00:00:00_0004.txt.gz\"\n", fmt.Sprintf("%v/2010/01/2010_01_01_00:00:00_0004.txt.gz: Invalid data found when processing input", tempdir)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			defer mockCmd(t, test.filename)()
+			builder := &strings.Builder{}
+			oldLogger := mediacleaner.Logger
+			mediacleaner.Logger = log.New(builder, "", 0)
+			defer func() { mediacleaner.Logger = oldLogger }()
+			mediacleaner.Output = ioutil.Discard
+
+			jb := &job{
+				fs:       fs,
+				root:     tempdir,
+				filename: test.filename,
+			}
+			gotErr := jb.Execute(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.ExecuteError); ok {
+				gotErr = ce.Cause
+			}
+
+			gotLog := builder.String()
+			if test.wantLog != gotLog {
+				t.Errorf("Wanted log %q got %q", test.wantLog, gotLog)
+			}
+
+			if gotErr == nil {
+				// make sure original file was removed
+				if _, err := fs.Stat(test.filename); !vfs.IsNotExist(err) {
+					t.Errorf("Wanted original file to have been removed, got %v", err)
+				}
+			} else {
+				// make sure original file still exists
+				if _, err := fs.Stat(test.filename); err != nil {
+					t.Errorf("Wanted original file still exist, got %v", err)
+				}
+
+				if test.wantErr != gotErr.Error() {
+					t.Errorf("Wanted error %q got %q", test.wantErr, gotErr.Error())
+				}
+			}
+		})
+	}
+}
+
+// blockingCmd starts processes that run until they are killed
+type blockingCmd struct {
+	started chan *blockingProcess
+}
+
+func (bc *blockingCmd) Path() string   { return "" }
+func (bc *blockingCmd) SetPath(string) {}
+func (bc *blockingCmd) Process() cmd.Process {
+	return &blockingProcess{started: bc.started, killed: make(chan struct{})}
+}
+
+type blockingProcess struct {
+	started  chan *blockingProcess
+	stderr   io.Writer
+	killed   chan struct{}
+	killOnce sync.Once
+}
+
+func (bp *blockingProcess) Args() []string            { return nil }
+func (bp *blockingProcess) AppendArgs(args ...string) {}
+func (bp *blockingProcess) Stdin(io.Reader)           {}
+func (bp *blockingProcess) Stdout(io.Writer)          {}
+func (bp *blockingProcess) Stderr(writer io.Writer)   { bp.stderr = writer }
+
+func (bp *blockingProcess) Start() error {
+	bp.started <- bp
+	return nil
+}
+
+func (bp *blockingProcess) Kill() error {
+	bp.killOnce.Do(func() {
+		close(bp.killed)
+		if closer, ok := bp.stderr.(io.Closer); ok {
+			closer.Close()
+		}
+	})
+	return nil
+}
+
+func (bp *blockingProcess) Wait() error {
+	<-bp.killed
+	return errors.New("signal: killed")
+}
+
+func TestJobCancel(t *testing.T) {
+	defer mockCmd(t, "/2010/01/2010_01_01_00:00:00_0003.mpg")()
+	ffm := &blockingCmd{started: make(chan *blockingProcess, 1)}
+	ffmpeg.Ffmpeg = ffm
+
+	fs := vfs.NewOsFs("testdata")
+	defer fs.Close()
+	mediacleaner.Output = ioutil.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jb := &job{fs: fs, root: "testdata", filename: "/2010/01/2010_01_01_00:00:00_0003.mpg"}
+	errCh := make(chan error, 1)
+	go func() { errCh <- jb.Execute(ctx) }()
+
+	var proc *blockingProcess
+	select {
+	case proc = <-ffm.started:
+	case err := <-errCh:
+		t.Fatalf("Wanted ffmpeg to be started, got %v", err)
+	}
+	cancel()
+
+	select {
+	case <-proc.killed:
+	case <-time.After(time.Second):
+		t.Fatalf("Wanted ffmpeg to be killed when the context was cancelled")
+	}
+
+	select {
+	case gotErr := <-errCh:
+		if !errors.Is(gotErr, context.Canceled) {
+			t.Errorf("Wanted %v got %v", context.Canceled, gotErr)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Wanted Execute to return once ffmpeg was killed")
+	}
+
+	if _, err := fs.Stat(jb.filename); err != nil {
+		t.Errorf("Wanted original file to still exist, got %v", err)
+	}
+}
+
+type argsProcess struct {
+	cmd.Process
+	args []string
+}
+
+func (ap *argsProcess) AppendArgs(args ...string) { ap.args = append(ap.args, args...) }
+func (ap *argsProcess) Start() error              { return nil }
+
+func TestThreadsProcess(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{"output file", []string{"-i", "in.mpg", "-c:v", "libx264", "-y", "out.mp4"}, []string{"-i", "in.mpg", "-c:v", "libx264", "-threads", "4", "-y", "out.mp4"}},
+		{"output writer", []string{"-i", "in.mpg", "-f", "null", "-"}, []string{"-i", "in.mpg", "-f", "null", "-threads", "4", "-"}},
+		{"no output", []string{"-i", "in.mpg"}, []string{"-i", "in.mpg", "-threads", "4"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inner := &argsProcess{}
+			proc := &threadsProcess{Process: inner, threads: "4"}
+			proc.AppendArgs(test.input...)
+			proc.Start()
+			if !reflect.DeepEqual(test.want, inner.args) {
+				t.Errorf("Wanted args %v got %v", test.want, inner.args)
+			}
+		})
+	}
+}
+
+func TestJobCheckLivePhoto(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+	vfs.MkdirAll(fs, "/2019/07", 0750)
+	fs.Create("/2019/07/2019_07_14_10:00:00_0000.heic")
+	fs.Create("/2019/07/2019_07_14_10:00:00_0000.mov")
+
+	tests := []struct {
+		live    string
+		wantErr error
+	}{
+		{"skip", errLivePhoto},
+		{"transcode", errNotVideo},
+	}
+
+	for _, test := range tests {
+		t.Run(test.live, func(t *testing.T) {
+			liveFlag = test.live
+			defer func() { liveFlag = "transcode" }()
+			defer mockCmd(t, "/2019/07/2019_07_14_10:00:00_0000.mov")()
+
+			jb := &job{fs: fs, root: "testdata/", filename: "/2019/07/2019_07_14_10:00:00_0000.mov"}
+			gotErr := jb.Check(context.Background())
+			if ce, ok := gotErr.(*mediacleaner.CheckError); ok {
+				gotErr = ce.Cause
+			}
+
+			if test.wantErr != gotErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, gotErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package mediacleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+var (
+	// CheckTimeout limits how long a job's Check may take, zero is no limit
+	CheckTimeout time.Duration
+
+	// ExecuteTimeout limits how long a job's Execute may take, zero is no limit
+	ExecuteTimeout time.Duration
+)
+
+// ContextJob is a Job whose Check and Execute are given a context that is
+// cancelled when the job times out or the process is aborted.  Jobs should
+// pass the context on to any child processes they start
+type ContextJob interface {
+	Name() string
+	Check(ctx context.Context) error
+	Execute(ctx context.Context) error
+}
+
+// Canceler is implemented by Jobs that can stop part way through Execute,
+// for instance by killing a child process.  Adapt cancels them when the
+// job's context is done
+type Canceler interface {
+	Cancel()
+}
+
+// Adapt wraps a Job so that it can be used as a ContextJob.  When the context
+// is done the job is cancelled, if it is a Canceler, and ctx.Err() is returned
+// without waiting for the job to finish
+func Adapt(job Job) ContextJob {
+	if job == nil {
+		return nil
+	}
+	return &jobAdapter{job}
+}
+
+type jobAdapter struct {
+	job Job
+}
+
+func (ja *jobAdapter) Name() string { return ja.job.Name() }
+
+func (ja *jobAdapter) Check(ctx context.Context) error {
+	return ja.run(ctx, ja.job.Check)
+}
+
+func (ja *jobAdapter) Execute(ctx context.Context) error {
+	return ja.run(ctx, ja.job.Execute)
+}
+
+func (ja *jobAdapter) run(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if canceler, ok := ja.job.(Canceler); ok {
+			canceler.Cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+// AdaptCallback wraps a FileCallback so that the jobs it creates are
+// adapted to ContextJobs
+func AdaptCallback(cb FileCallback) ContextFileCallback {
+	return func(fs vfs.FileSystem, filename string, root string) ContextJob {
+		if job := cb(fs, filename, root); job != nil {
+			return Adapt(job)
+		}
+		return nil
+	}
+}
+
+// TimeLimiter is implemented by jobs that need other limits than
+// CheckTimeout and ExecuteTimeout, zero is no limit
+type TimeLimiter interface {
+	TimeLimits() (check, execute time.Duration)
+}
+
+// SetTimeouts changes the default check and execute timeouts.  Commands
+// call it from init so that -check-timeout and -execute-timeout default
+// to values that suit their jobs
+func SetTimeouts(check, execute time.Duration) {
+	CheckTimeout, ExecuteTimeout = check, execute
+	Flags.Lookup("check-timeout").DefValue = check.String()
+	Flags.Lookup("execute-timeout").DefValue = execute.String()
+}
+
+// withTimeout calls fn with a context that is cancelled after timeout
+func withTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := fn(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %v: %w", timeout, err)
+	}
+	return err
+}
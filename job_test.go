@@ -0,0 +1,160 @@
+package mediacleaner
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+// legacyJob is a Job without a context, it blocks until released
+// or cancelled
+type legacyJob struct {
+	release   chan bool
+	cancelled bool
+	err       error
+}
+
+func (lj *legacyJob) Name() string { return "legacy" }
+func (lj *legacyJob) Check() error { return lj.err }
+
+func (lj *legacyJob) Execute() error {
+	<-lj.release
+	return lj.err
+}
+
+func (lj *legacyJob) Cancel() {
+	lj.cancelled = true
+	close(lj.release)
+}
+
+func TestAdapt(t *testing.T) {
+	if Adapt(nil) != nil {
+		t.Errorf("Wanted a nil job to adapt to nil")
+	}
+
+	jb := &legacyJob{release: make(chan bool), err: ErrUnknownDateFormat}
+	adapted := Adapt(jb)
+	if adapted.Name() != "legacy" {
+		t.Errorf("Wanted name %q got %q", "legacy", adapted.Name())
+	}
+
+	if err := adapted.Check(context.Background()); err != ErrUnknownDateFormat {
+		t.Errorf("Wanted %v got %v", ErrUnknownDateFormat, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := adapted.Execute(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wanted %v got %v", context.DeadlineExceeded, err)
+	}
+
+	if !jb.cancelled {
+		t.Errorf("Wanted the job to be cancelled")
+	}
+}
+
+func TestAdaptCallback(t *testing.T) {
+	cb := AdaptCallback(func(fs vfs.FileSystem, filename string, root string) Job {
+		if filename == "/skip" {
+			return nil
+		}
+		return &legacyJob{}
+	})
+
+	if cb(nil, "/skip", "/") != nil {
+		t.Errorf("Wanted a nil job to adapt to nil")
+	}
+
+	if _, ok := cb(nil, "/foo", "/").(*jobAdapter); !ok {
+		t.Errorf("Wanted the job to be adapted")
+	}
+}
+
+type sleepJob struct {
+	testJob
+}
+
+func (sj *sleepJob) Execute(ctx context.Context) error {
+	select {
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+		return errors.New("killed")
+	}
+	return sj.testJob.Execute(ctx)
+}
+
+func TestRunJobTimeout(t *testing.T) {
+	oldTimeout := ExecuteTimeout
+	ExecuteTimeout = 10 * time.Millisecond
+	defer func() { ExecuteTimeout = oldTimeout }()
+
+	builder := &strings.Builder{}
+	oldLogger := Logger
+	Logger = log.New(builder, "", 0)
+	defer func() { Logger = oldLogger }()
+
+	jb := &sleepJob{testJob{name: "foo"}}
+	RunJob(context.Background(), jb)
+	if jb.execute {
+		t.Errorf("Wanted the job to be stopped")
+	}
+
+	want := "Failed to process foo: timed out after 10ms: killed\n"
+	if got := builder.String(); want != got {
+		t.Errorf("Wanted log %q got %q", want, got)
+	}
+}
+
+// limitedJob is a sleepJob with its own execute limit
+type limitedJob struct {
+	sleepJob
+	limit time.Duration
+}
+
+func (lj *limitedJob) TimeLimits() (check, execute time.Duration) {
+	return 0, lj.limit
+}
+
+func TestRunJobTimeLimits(t *testing.T) {
+	oldTimeout := ExecuteTimeout
+	ExecuteTimeout = 10 * time.Millisecond
+	defer func() { ExecuteTimeout = oldTimeout }()
+
+	tests := []struct {
+		name        string
+		limit       time.Duration
+		wantExecute bool
+	}{
+		{"no limit", 0, true},
+		{"shorter limit", time.Millisecond, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jb := &limitedJob{sleepJob{testJob{name: "foo"}}, test.limit}
+			RunJob(context.Background(), jb)
+			if test.wantExecute != jb.execute {
+				t.Errorf("Wanted execute %v got %v", test.wantExecute, jb.execute)
+			}
+		})
+	}
+}
+
+func TestSetTimeouts(t *testing.T) {
+	oldCheck, oldExecute := CheckTimeout, ExecuteTimeout
+	defer SetTimeouts(oldCheck, oldExecute)
+
+	SetTimeouts(time.Minute, time.Hour)
+	if CheckTimeout != time.Minute || ExecuteTimeout != time.Hour {
+		t.Errorf("Wanted timeouts %v and %v got %v and %v", time.Minute, time.Hour, CheckTimeout, ExecuteTimeout)
+	}
+
+	if got := Flags.Lookup("execute-timeout").DefValue; got != "1h0m0s" {
+		t.Errorf("Wanted default %q got %q", "1h0m0s", got)
+	}
+}
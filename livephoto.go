@@ -0,0 +1,64 @@
+package mediacleaner
+
+import (
+	"path"
+	"strings"
+
+	"github.com/mh-orange/vfs"
+)
+
+var (
+	// LivePhotoStillExts are the extensions of the still image half of
+	// a Live Photo or Motion Photo
+	LivePhotoStillExts = map[string]bool{".heic": true, ".heif": true, ".jpg": true, ".jpeg": true}
+
+	// LivePhotoMotionExts are the extensions of the video half of a
+	// Live Photo or Motion Photo
+	LivePhotoMotionExts = map[string]bool{".mov": true, ".mp4": true}
+)
+
+// Stem returns the filename without the directory or extension
+func Stem(filename string) string {
+	base := path.Base(filename)
+	return base[0 : len(base)-len(path.Ext(base))]
+}
+
+// Companions returns the other files in the same directory that share the
+// filename's stem, for instance IMG_1234.MOV is a companion of IMG_1234.HEIC
+func Companions(fs vfs.FileSystem, filename string) ([]string, error) {
+	dir := path.Dir(filename)
+	stem := Stem(filename)
+	entries, err := vfs.Glob(fs, path.Join(dir, stem+".*"))
+	companions := []string{}
+	for _, entry := range entries {
+		if entry != filename && Stem(entry) == stem {
+			companions = append(companions, entry)
+		}
+	}
+	return companions, err
+}
+
+// IsLivePhotoPair determines if the two files could be the still and motion
+// halves of a Live Photo, in either order
+func IsLivePhotoPair(filename1, filename2 string) bool {
+	ext1 := strings.ToLower(path.Ext(filename1))
+	ext2 := strings.ToLower(path.Ext(filename2))
+	return (LivePhotoStillExts[ext1] && LivePhotoMotionExts[ext2]) || (LivePhotoMotionExts[ext1] && LivePhotoStillExts[ext2])
+}
+
+// LivePhotoStill returns the still image that accompanies a Live Photo's
+// motion file.  An empty string is returned if filename is not the motion
+// half of a Live Photo
+func LivePhotoStill(fs vfs.FileSystem, filename string) string {
+	if !LivePhotoMotionExts[strings.ToLower(path.Ext(filename))] {
+		return ""
+	}
+
+	companions, _ := Companions(fs, filename)
+	for _, companion := range companions {
+		if LivePhotoStillExts[strings.ToLower(path.Ext(companion))] {
+			return companion
+		}
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package mediacleaner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+)
+
+func TestCompanions(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+	vfs.MkdirAll(fs, "/2019/07", 0755)
+	for _, filename := range []string{"/2019/07/IMG_1234.HEIC", "/2019/07/IMG_1234.MOV", "/2019/07/IMG_1234.xmp", "/2019/07/IMG_12345.MOV", "/2019/07/IMG_1235.JPG"} {
+		fs.Create(filename)
+	}
+
+	tests := []struct {
+		input     string
+		want      []string
+		wantStill string
+	}{
+		{"/2019/07/IMG_1234.HEIC", []string{"/2019/07/IMG_1234.MOV", "/2019/07/IMG_1234.xmp"}, ""},
+		{"/2019/07/IMG_1234.MOV", []string{"/2019/07/IMG_1234.HEIC", "/2019/07/IMG_1234.xmp"}, "/2019/07/IMG_1234.HEIC"},
+		{"/2019/07/IMG_12345.MOV", []string{}, ""},
+		{"/2019/07/IMG_1235.JPG", []string{}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := Companions(fs, test.input)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted companions %v got %v", test.want, got)
+			}
+
+			gotStill := LivePhotoStill(fs, test.input)
+			if test.wantStill != gotStill {
+				t.Errorf("Wanted still %q got %q", test.wantStill, gotStill)
+			}
+		})
+	}
+}
+
+func TestIsLivePhotoPair(t *testing.T) {
+	tests := []struct {
+		input1 string
+		input2 string
+		want   bool
+	}{
+		{"IMG_1234.HEIC", "IMG_1234.MOV", true},
+		{"IMG_1234.MOV", "IMG_1234.jpg", true},
+		{"IMG_1234.jpg", "IMG_1234.HEIC", false},
+		{"IMG_1234.MOV", "IMG_1234.xmp", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input1+" "+test.input2, func(t *testing.T) {
+			got := IsLivePhotoPair(test.input1, test.input2)
+			if test.want != got {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
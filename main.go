@@ -1,6 +1,7 @@
 package mediacleaner
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -40,6 +41,24 @@ var (
 	QuietFlag   bool
 	versionFlag bool
 
+	// SettleFlag is how long a newly created file's size and modification
+	// time must stay the same before it is processed in watch mode
+	SettleFlag = 5 * time.Second
+
+	// RescanIntervalFlag is how often watched roots are walked again to
+	// find files whose events were missed, zero disables rescanning
+	RescanIntervalFlag time.Duration
+
+	// Concurrency is the maximum number of jobs that will be executed
+	// at the same time.  Values less than 1 are treated as 1
+	Concurrency = 1
+
+	// PrefixLock must be held from choosing a file's name with GetPrefix
+	// until the file has been moved there.  Otherwise, when jobs run
+	// concurrently, two files taken in the same second can be given the
+	// same name and the second would replace the first
+	PrefixLock sync.Mutex
+
 	ErrUnknownDateFormat = errors.New("Unknown date format")
 
 	Output = io.Writer(os.Stderr)
@@ -73,6 +92,8 @@ type ExecuteError struct {
 func (err *ExecuteError) Unwrap() error { return err.Cause }
 func (err *ExecuteError) Error() string { return fmt.Sprintf("job execution failed: %s", err.Msg) }
 
+// Job is a job that can't be cancelled or timed out, use Adapt
+// to run it as a ContextJob
 type Job interface {
 	Name() string
 	Check() error
@@ -81,6 +102,9 @@ type Job interface {
 
 type FileCallback func(fs vfs.FileSystem, filename string, root string) Job
 
+// ContextFileCallback is a FileCallback that creates ContextJobs
+type ContextFileCallback func(fs vfs.FileSystem, filename string, root string) ContextJob
+
 func GetDateFromFilename(filename string) (t time.Time, err error) {
 	match := []byte(path.Base(filename))
 	for exp, layout := range filePrefixes {
@@ -115,10 +139,18 @@ func skip(info os.FileInfo, filename string) bool {
 	return false
 }
 
-func walk(fs vfs.FileSystem, root string, queue chan<- Job, cb FileCallback) vfs.WalkFunc {
+func walk(fs vfs.FileSystem, root string, queue chan<- ContextJob, cb ContextFileCallback) vfs.WalkFunc {
+	filter := newFilter(fs)
 	return func(filename string, info os.FileInfo, err error) error {
-		if err != nil || skip(info, filename) {
+		if err != nil {
 			return err
+		} else if filter.excluded(filename, info.IsDir()) {
+			if info.IsDir() {
+				return vfs.ErrSkipDir
+			}
+			return nil
+		} else if skip(info, filename) || !wanted(fs, filename) {
+			return nil
 		}
 
 		job := cb(fs, filename, root)
@@ -129,24 +161,209 @@ func walk(fs vfs.FileSystem, root string, queue chan<- Job, cb FileCallback) vfs
 	}
 }
 
-func watch(fs vfs.FileSystem, root string, events <-chan vfs.Event, jobQueue chan<- Job, cb FileCallback) {
-	walkFn := walk(fs, root, jobQueue, cb)
-	for event := range events {
-		if event.Type&vfs.CreateEvent == vfs.CreateEvent {
-			info, err := fs.Stat(event.Path)
-			err = walkFn(event.Path, info, err)
+// watch processes the files that are created in, or moved into, the root.
+// The root is periodically rescanned when RescanIntervalFlag is set, and
+// whenever the watcher reports an error such as an event queue overflow,
+// to pick up files whose events were missed.  handled records the files
+// that have already been processed, including by an initial scan, and may
+// be nil
+func watch(fs vfs.FileSystem, root string, watcher vfs.Watcher, events <-chan vfs.Event, jobQueue chan<- ContextJob, cb ContextFileCallback, handled *handledFiles) {
+	if handled == nil {
+		handled = newHandledFiles()
+	}
+	walkFn := walk(fs, root, jobQueue, handled.track(cb))
+	filter := newFilter(fs)
+	settling := newSettler(SettleFlag)
+	var tick <-chan time.Time
+	if SettleFlag > 0 {
+		ticker := time.NewTicker(SettleFlag / 4)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var rescanTick <-chan time.Time
+	if RescanIntervalFlag > 0 {
+		ticker := time.NewTicker(RescanIntervalFlag)
+		defer ticker.Stop()
+		rescanTick = ticker.C
+	}
+
+	addFile := func(filename string, info os.FileInfo) {
+		if filter.excluded(filename, false) {
+			return
+		} else if SettleFlag > 0 {
+			// wait for the file to finish being written
+			settling.add(filename, info)
+		} else {
+			walkFn(filename, info, nil)
+		}
+	}
+
+	// directories that appear, whether created or moved into the root, are
+	// watched and walked so that files already inside them are processed
+	addDir := func(dir string) {
+		vfs.Walk(fs, dir, func(filename string, info os.FileInfo, err error) error {
+			if err != nil {
+				Errorf("error when trying to walk new directory %q: %v", filename, err)
+			} else if filter.excluded(filename, info.IsDir()) {
+				if info.IsDir() {
+					return vfs.ErrSkipDir
+				}
+			} else if !info.IsDir() {
+				addFile(filename, info)
+			} else if watcher != nil {
+				if err := watcher.Watch(filename); err != nil {
+					Errorf("Failed to watch %q: %v", filename, err)
+				}
+			}
+			return nil
+		})
+	}
+
+	rescan := func() {
+		Infof("Rescanning %q", root)
+		seen := make(map[string]bool)
+		vfs.Walk(fs, "/", func(filename string, info os.FileInfo, err error) error {
 			if err != nil {
-				Errorf("error when trying to stat newly created file %q: %v", event.Path, err)
+				Errorf("error when trying to rescan %q: %v", filename, err)
+			} else if info.IsDir() && filter.excluded(filename, true) {
+				return vfs.ErrSkipDir
+			} else if info.IsDir() {
+				if watcher != nil {
+					watcher.Watch(filename)
+				}
+			} else if _, settling := settling.files[filename]; !settling && !handled.handled(filename, info) {
+				addFile(filename, info)
+			}
+
+			if err == nil && !info.IsDir() {
+				seen[filename] = true
 			}
+			return nil
+		})
+		handled.prune(fs, seen)
+	}
+
+	for {
+		select {
+		case event, open := <-events:
+			if !open {
+				return
+			}
+
+			if event.Type&vfs.ErrorEvent == vfs.ErrorEvent {
+				// events may have been lost
+				Errorf("Watch error on %q: %v", root, event.Error)
+				rescan()
+			} else if event.Type&(vfs.CreateEvent|vfs.RenameEvent) != 0 {
+				// renames are reported with the old name by some file systems
+				// and the new name by others, if the file is gone it was
+				// moved away
+				info, err := fs.Stat(event.Path)
+				if err != nil {
+					settling.remove(event.Path)
+					handled.forget(event.Path)
+					if event.Type&vfs.CreateEvent == vfs.CreateEvent {
+						Errorf("error when trying to stat newly created file %q: %v", event.Path, err)
+					}
+				} else if info.IsDir() {
+					addDir(event.Path)
+				} else {
+					addFile(event.Path, info)
+				}
+			} else if event.Type&vfs.ModifyEvent == vfs.ModifyEvent {
+				settling.touch(event.Path)
+			} else if event.Type&vfs.RemoveEvent == vfs.RemoveEvent {
+				settling.remove(event.Path)
+				handled.forget(event.Path)
+			}
+		case <-tick:
+			for filename, info := range settling.settled(fs) {
+				walkFn(filename, info, nil)
+			}
+		case <-rescanTick:
+			rescan()
+		}
+	}
+}
+
+// RunJob checks the job and, if the checks pass, executes it.  The check
+// and execution are limited by CheckTimeout and ExecuteTimeout, or the
+// job's own limits when it is a TimeLimiter.  Skipped
+// jobs and failures are logged, the failure is returned
+func RunJob(ctx context.Context, job ContextJob) error {
+	check, execute := CheckTimeout, ExecuteTimeout
+	if limiter, ok := job.(TimeLimiter); ok {
+		check, execute = limiter.TimeLimits()
+	}
+
+	ce := &CheckError{}
+	err := withTimeout(ctx, check, job.Check)
+	if err == nil {
+		err = withTimeout(ctx, execute, job.Execute)
+		if err != nil {
+			Errorf("Failed to process %s: %v", job.Name(), err)
+		}
+	} else if errors.As(err, &ce) {
+		Infof("Skipping %s: %v", job.Name(), errors.Unwrap(err))
+		err = nil
+	} else {
+		Errorf("Failed to perform checks on %s: %v", job.Name(), err)
+	}
+	return err
+}
+
+// workerKey is the context key of the worker running a job
+type workerKey struct{}
+
+// worker holds the Concurrency slot of the job it runs
+type worker struct {
+	p   *Process
+	sem chan struct{}
+}
+
+// Idle gives up the job's worker slot while fn waits, for instance for a
+// time window to open, so that other jobs can run.  fn is given a context
+// that is also done when the process shuts down and the slot is taken back
+// before Idle returns
+func Idle(ctx context.Context, fn func(ctx context.Context) error) error {
+	w, ok := ctx.Value(workerKey{}).(*worker)
+	if !ok {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-w.p.stopCh:
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+
+	<-w.sem
+	err := fn(ctx)
+	w.sem <- struct{}{}
+	if w.p.Stopped() {
+		w.p.incomplete()
+		err = errStopped
 	}
+	return err
 }
 
-func (p *Process) process(queue <-chan Job) {
+func (p *Process) process(queue <-chan ContextJob) {
 	errChs := []chan error{}
 	watchers := []vfs.Watcher{}
 	done := false
-	ce := &CheckError{}
+
+	workers := Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	running := sync.WaitGroup{}
+
 	for !done {
 		select {
 		case job, open := <-queue:
@@ -154,17 +371,28 @@ func (p *Process) process(queue <-chan Job) {
 				done = true
 				continue
 			}
-			err := job.Check()
-			if err == nil {
-				err = job.Execute()
-				if err != nil {
-					Errorf("Failed to process %s: %v", job.Name(), err)
-				}
-			} else if errors.As(err, &ce) {
-				Infof("Skipping %s: %v", job.Name(), errors.Unwrap(err))
-			} else {
-				Errorf("Failed to perform checks on %s: %v", job.Name(), err)
+			if p.Stopped() {
+				// jobs are no longer accepted, but the queue is drained
+				// so that scans and watches aren't blocked
+				p.incomplete()
+				continue
+			}
+
+			sem <- struct{}{}
+			if p.Stopped() {
+				<-sem
+				p.incomplete()
+				continue
 			}
+
+			running.Add(1)
+			p.started(job)
+			go func(job ContextJob) {
+				RunJob(context.WithValue(p.ctx, workerKey{}, &worker{p: p, sem: sem}), job)
+				p.finished(job)
+				<-sem
+				running.Done()
+			}(job)
 		case errCh := <-p.killCh:
 			errChs = append(errChs, errCh)
 			for _, watcher := range watchers {
@@ -178,6 +406,7 @@ func (p *Process) process(queue <-chan Job) {
 			watchers = append(watchers, watcher)
 		}
 	}
+	running.Wait()
 
 	for _, errCh := range errChs {
 		errCh <- nil
@@ -192,6 +421,12 @@ func (p *Process) Kill() (err error) {
 	return <-wait
 }
 
+// Context returns the context given to the process's jobs, it is cancelled
+// when the process is aborted by a second signal
+func (p *Process) Context() context.Context {
+	return p.ctx
+}
+
 // Wait for the process to complete
 func (p *Process) Wait() {
 	p.pwg.Wait()
@@ -202,6 +437,45 @@ type Process struct {
 	watcherCh chan vfs.Watcher
 	pwg       sync.WaitGroup
 	wg        sync.WaitGroup
+
+	// stopCh is closed when the process is shutting down
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	remaining int32
+
+	// ctx is passed to the jobs, it is cancelled to abort them
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// running maps the jobs that are executing to channels
+	// that are closed when they finish
+	runningMu sync.Mutex
+	running   map[ContextJob]chan struct{}
+}
+
+func newProcess() *Process {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Process{
+		killCh:    make(chan chan error),
+		watcherCh: make(chan vfs.Watcher),
+		stopCh:    make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		running:   make(map[ContextJob]chan struct{}),
+	}
+}
+
+func (p *Process) started(job ContextJob) {
+	p.runningMu.Lock()
+	p.running[job] = make(chan struct{})
+	p.runningMu.Unlock()
+}
+
+func (p *Process) finished(job ContextJob) {
+	p.runningMu.Lock()
+	close(p.running[job])
+	delete(p.running, job)
+	p.runningMu.Unlock()
 }
 
 func init() {
@@ -210,6 +484,13 @@ func init() {
 	Flags.BoolVar(&QuietFlag, "q", false, "quiet - hide the progress bar")
 	Flags.BoolVar(&ScanFlag, "s", false, "scan - scan directories and process the files")
 	Flags.BoolVar(&WatchFlag, "w", false, "watch - watch for changes to the filesystem and process newly created files")
+	Flags.DurationVar(&SettleFlag, "settle", SettleFlag, "settle - in watch mode, only process new files once their size and modification time haven't changed for this long (0 processes them immediately)")
+	Flags.DurationVar(&RescanIntervalFlag, "rescan-interval", 0, "rescan-interval - in watch mode, walk each directory again this often to find files whose events were missed (e.g. on NFS/SMB mounts)")
+	Flags.Var(&IncludeFlag, "include", "include - comma separated glob patterns, only matching files are processed")
+	Flags.Var(&ExcludeFlag, "exclude", "exclude - comma separated glob patterns of files and directories that are not processed, "+IgnoreFile+" at the top of a directory can list more, one per line")
+	Flags.Var(&TypesFlag, "types", "types - comma separated media types (image, video, audio) of the files that are processed, others are skipped without running exiftool or ffmpeg (empty processes every file)")
+	Flags.DurationVar(&CheckTimeout, "check-timeout", 0, "check-timeout - give up checking a file after this long, killing any exiftool or ffmpeg started for it (0 is no limit)")
+	Flags.DurationVar(&ExecuteTimeout, "execute-timeout", 0, "execute-timeout - give up processing a file after this long, killing any exiftool or ffmpeg started for it (0 is no limit)")
 	Flags.BoolVar(&versionFlag, "v", false, "version - display the program version and exit")
 	Flags.Usage = func() {
 		fmt.Fprintf(Flags.Output(), "Usage: %s [options] <dir1> <dir2> ...\n\nOptions:\n", os.Args[0])
@@ -217,55 +498,85 @@ func init() {
 	}
 }
 
+// Run parses the command line flags and starts processing the
+// directories that follow them
 func Run(args []string, cb FileCallback) *Process {
+	return RunContext(args, AdaptCallback(cb))
+}
+
+// RunContext is Run for callbacks that create ContextJobs
+func RunContext(args []string, cb ContextFileCallback) *Process {
 	Flags.Parse(args[1:])
+	return Start(Flags.Args(), cb)
+}
+
+// Start processes the roots once the flags have been parsed.  The files
+// found by scanning and watching the roots are given to the callback
+func Start(roots []string, cb ContextFileCallback) *Process {
 	if versionFlag {
 		fmt.Fprintf(os.Stdout, "%s version %s %s/%s\n", filepath.Base(os.Args[0]), Version, runtime.GOOS, runtime.GOARCH)
 		os.Exit(0)
 	}
 
-	if len(Flags.Args()) < 1 {
+	if len(roots) < 1 {
 		Flags.Usage()
 		os.Exit(1)
 	}
 
-	p := &Process{
-		killCh:    make(chan chan error),
-		watcherCh: make(chan vfs.Watcher),
-	}
-	queue := make(chan Job)
-	events := make(chan vfs.Event, 16384)
+	p := newProcess()
+	queue := make(chan ContextJob)
+	notifySignals(p)
 
 	p.pwg.Add(1)
 	Infof("Starting processing thread")
 	go func() {
 		p.process(queue)
+		if err := CloseExifTool(); err != nil {
+			Errorf("Failed to stop exiftool: %v", err)
+		}
 		p.pwg.Done()
 	}()
 
-	for _, path := range Flags.Args() {
+	for _, path := range roots {
 		fs := vfs.NewOsFs(path)
+		handled := newHandledFiles()
 		if ScanFlag {
 			Infof("Scanning %q", path)
 			p.wg.Add(1)
-			go func(fs vfs.FileSystem) {
-				vfs.Walk(fs, "/", walk(fs, path, queue, cb))
+			go func(fs vfs.FileSystem, path string) {
+				walkFn := walk(fs, path, queue, handled.track(cb))
+				vfs.Walk(fs, "/", func(filename string, info os.FileInfo, err error) error {
+					if p.Stopped() {
+						p.incomplete()
+						return errStopped
+					}
+					return walkFn(filename, info, err)
+				})
 				p.wg.Done()
-			}(fs)
+			}(fs, path)
 		}
 
 		if WatchFlag {
 			p.wg.Add(1)
-			watcher, err := vfs.Watch(fs, "/", events)
+			events := make(chan vfs.Event, 16384)
+			var watcher vfs.Watcher
+			_, err := fs.Stat("/")
 			if err == nil {
+				watcher, err = fs.Watcher(events)
+			}
+
+			if err == nil {
+				// excluded directories aren't watched
+				newFilter(fs).watchDirs(fs, "/", watcher)
 				p.watcherCh <- watcher
-				go func(fs vfs.FileSystem) {
+				go func(fs vfs.FileSystem, path string, watcher vfs.Watcher) {
 					Infof("Watching %q", path)
-					watch(fs, path, events, queue, cb)
+					watch(fs, path, watcher, events, queue, cb, handled)
 					p.wg.Done()
-				}(fs)
+				}(fs, path, watcher)
 			} else {
 				Errorf("Failed to start watch: %v", err)
+				p.wg.Done()
 			}
 		}
 	}
@@ -1,6 +1,7 @@
 package mediacleaner
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -148,12 +149,12 @@ type testJob struct {
 }
 
 func (tj *testJob) Name() string { return tj.name }
-func (tj *testJob) Check() error {
+func (tj *testJob) Check(ctx context.Context) error {
 	tj.check = true
 	return tj.checkErr
 }
 
-func (tj *testJob) Execute() error {
+func (tj *testJob) Execute(ctx context.Context) error {
 	tj.execute = true
 	return tj.executeErr
 }
@@ -163,7 +164,7 @@ func TestWalk(t *testing.T) {
 		name         string
 		filename     string
 		fileInfo     os.FileInfo
-		job          Job
+		job          ContextJob
 		err          error
 		wantQueueLen int
 		want         []string
@@ -175,11 +176,11 @@ func TestWalk(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			queue := make(chan Job, 1)
+			queue := make(chan ContextJob, 1)
 			got := []string{}
 			fs := vfs.NewMemFs()
 			defer fs.Close()
-			walkFn := walk(fs, "", queue, func(fs vfs.FileSystem, filename string, root string) Job {
+			walkFn := walk(fs, "", queue, func(fs vfs.FileSystem, filename string, root string) ContextJob {
 				got = append(got, filename)
 				return test.job
 			})
@@ -199,7 +200,7 @@ func TestWatch(t *testing.T) {
 	tests := []struct {
 		name         string
 		event        vfs.Event
-		job          Job
+		job          ContextJob
 		wantQueueLen int
 		wantLog      string
 	}{
@@ -213,17 +214,17 @@ func TestWatch(t *testing.T) {
 			oldLogger := Logger
 			Logger = log.New(builder, "", 0)
 			defer func() { Logger = oldLogger }()
-			jobQueue := make(chan Job, 1)
+			jobQueue := make(chan ContextJob, 1)
 			events := make(chan vfs.Event, 1)
 			events <- test.event
 			close(events)
 			got := []string{}
 			fs := vfs.NewMemFs()
 			defer fs.Close()
-			watch(fs, "", events, jobQueue, func(fs vfs.FileSystem, filename string, root string) Job {
+			watch(fs, "", nil, events, jobQueue, func(fs vfs.FileSystem, filename string, root string) ContextJob {
 				got = append(got, filename)
 				return test.job
-			})
+			}, nil)
 
 			if len(jobQueue) != test.wantQueueLen {
 				t.Errorf("Wanted %d items in the job queue, got %d", test.wantQueueLen, len(jobQueue))
@@ -257,7 +258,7 @@ func TestProcess(t *testing.T) {
 			Logger = log.New(builder, "", 0)
 			fs := vfs.NewMemFs()
 			defer fs.Close()
-			queue := make(chan Job, 1)
+			queue := make(chan ContextJob, 1)
 			if test.scanJob != nil {
 				queue <- test.scanJob
 			}
@@ -265,7 +266,7 @@ func TestProcess(t *testing.T) {
 				queue <- test.watchJob
 			}
 			close(queue)
-			p := &Process{}
+			p := newProcess()
 			p.process(queue)
 			if test.scanJob != nil && test.wantScanExecute != test.scanJob.execute {
 				t.Errorf("Wanted scan execute to be %v got %v", test.wantScanExecute, test.scanJob.execute)
@@ -282,6 +283,60 @@ func TestProcess(t *testing.T) {
 	}
 }
 
+type blockingJob struct {
+	testJob
+	started chan<- bool
+	release <-chan bool
+}
+
+func (bj *blockingJob) Execute(ctx context.Context) error {
+	bj.started <- true
+	<-bj.release
+	return bj.testJob.Execute(ctx)
+}
+
+func TestProcessConcurrency(t *testing.T) {
+	oldConcurrency := Concurrency
+	Concurrency = 2
+	defer func() { Concurrency = oldConcurrency }()
+
+	started := make(chan bool)
+	release := make(chan bool)
+	queue := make(chan ContextJob, 2)
+	jobs := []*blockingJob{
+		{testJob: testJob{name: "foo"}, started: started, release: release},
+		{testJob: testJob{name: "bar"}, started: started, release: release},
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+
+	done := make(chan bool)
+	p := newProcess()
+	go func() {
+		p.process(queue)
+		done <- true
+	}()
+
+	// both jobs must be running at the same time before either is released
+	for range jobs {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for jobs to run concurrently")
+		}
+	}
+	close(release)
+	<-done
+
+	for _, job := range jobs {
+		if !job.execute {
+			t.Errorf("Wanted %s to be executed", job.name)
+		}
+	}
+}
+
 func TestRunScan(t *testing.T) {
 	ScanFlag = false
 	WatchFlag = false
@@ -328,7 +383,7 @@ func TestRunWatch(t *testing.T) {
 	done := make(chan bool)
 	want := "/foo/bar/done.txt"
 	os.MkdirAll(filepath.Join(tempdir, "/foo/bar"), 0750)
-	p := Run([]string{"foo", "-w", tempdir}, func(fs vfs.FileSystem, filename string, root string) Job {
+	p := RunContext([]string{"foo", "-w", "-settle", "100ms", tempdir}, func(fs vfs.FileSystem, filename string, root string) ContextJob {
 		if filename != want {
 			t.Errorf("Wanted %q got %q", want, filename)
 		}
@@ -350,3 +405,66 @@ func TestRunWatch(t *testing.T) {
 		t.Errorf("Wanted log %q got %q", wantLog, gotLog)
 	}
 }
+
+func TestWatchNewDirectory(t *testing.T) {
+	oldSettle := SettleFlag
+	SettleFlag = 0
+	defer func() { SettleFlag = oldSettle }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	outside, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(outside)
+	root := filepath.Join(tempdir, "root")
+	os.MkdirAll(root, 0750)
+
+	fs := vfs.NewOsFs(root)
+	events := make(chan vfs.Event, 16)
+	watcher, err := vfs.Watch(fs, "/", events)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	queued := make(chan string, 16)
+	done := make(chan bool)
+	go func() {
+		watch(fs, root, watcher, events, nil, func(fs vfs.FileSystem, filename string, root string) ContextJob {
+			queued <- filename
+			return nil
+		}, nil)
+		done <- true
+	}()
+
+	wait := func(want string) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case got := <-queued:
+				if got == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("Timed out waiting for %q", want)
+			}
+		}
+	}
+
+	// a directory tree copied into the root
+	os.MkdirAll(filepath.Join(outside, "DCIM/100CANON"), 0750)
+	ioutil.WriteFile(filepath.Join(outside, "DCIM/100CANON/IMG_0001.JPG"), nil, 0640)
+	os.Rename(filepath.Join(outside, "DCIM"), filepath.Join(root, "DCIM"))
+	wait("/DCIM/100CANON/IMG_0001.JPG")
+
+	// files created later inside the new directory
+	ioutil.WriteFile(filepath.Join(root, "DCIM/100CANON/IMG_0002.JPG"), nil, 0640)
+	wait("/DCIM/100CANON/IMG_0002.JPG")
+
+	// a file moved into the new directory
+	ioutil.WriteFile(filepath.Join(outside, "IMG_0003.JPG"), nil, 0640)
+	os.Rename(filepath.Join(outside, "IMG_0003.JPG"), filepath.Join(root, "DCIM/100CANON/IMG_0003.JPG"))
+	wait("/DCIM/100CANON/IMG_0003.JPG")
+
+	watcher.Close()
+	<-done
+}
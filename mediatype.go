@@ -0,0 +1,323 @@
+package mediacleaner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/mh-orange/vfs"
+)
+
+// MediaType is the kind of media held by a file
+type MediaType string
+
+const (
+	Image MediaType = "image"
+	Video MediaType = "video"
+	Audio MediaType = "audio"
+	Other MediaType = "other"
+)
+
+// sniffLen is the number of bytes read from the start of a file to
+// detect its content type
+const sniffLen = 512
+
+var (
+	// TypesFlag lists the media types that are processed, other files
+	// are skipped before a job is created for them.  Empty processes
+	// every file
+	TypesFlag typeList
+
+	// extTypes are the MIME types of media whose content can't be told
+	// apart by its first bytes, such as the camera raw formats based on
+	// TIFF, or isn't detected
+	extTypes = map[string]string{
+		".arw":  "image/x-sony-arw",
+		".cr2":  "image/x-canon-cr2",
+		".cr3":  "image/x-canon-cr3",
+		".dng":  "image/x-adobe-dng",
+		".nef":  "image/x-nikon-nef",
+		".orf":  "image/x-olympus-orf",
+		".pef":  "image/x-pentax-pef",
+		".raf":  "image/x-fuji-raf",
+		".rw2":  "image/x-panasonic-rw2",
+		".srw":  "image/x-samsung-srw",
+		".m2ts": "video/mp2t",
+		".mts":  "video/mp2t",
+	}
+
+	// canonicalExts maps other spellings of extensions to the one that
+	// files are given
+	canonicalExts = map[string]string{
+		".jpeg": ".jpg", ".jpe": ".jpg", ".jfif": ".jpg",
+		".tiff": ".tif",
+		".qt":   ".mov",
+		".mpeg": ".mpg", ".mpe": ".mpg",
+		".3gpp": ".3gp",
+	}
+
+	// contentExts are the extensions of files holding each MIME type
+	contentExts = map[string]string{
+		"image/jpeg":          ".jpg",
+		"image/png":           ".png",
+		"image/gif":           ".gif",
+		"image/bmp":           ".bmp",
+		"image/webp":          ".webp",
+		"image/heic":          ".heic",
+		"image/heif":          ".heif",
+		"image/avif":          ".avif",
+		"video/quicktime":     ".mov",
+		"video/mp4":           ".mp4",
+		"video/3gpp":          ".3gp",
+		"video/x-matroska":    ".mkv",
+		"video/webm":          ".webm",
+		"video/avi":           ".avi",
+		"video/mpeg":          ".mpg",
+		"audio/mpeg":          ".mp3",
+		"audio/flac":          ".flac",
+		"audio/wave":          ".wav",
+		"image/x-canon-cr3":   ".cr3",
+		"image/x-olympus-orf": ".orf",
+		"image/x-fuji-raf":    ".raf",
+	}
+
+	// containers groups the extensions of formats that share a container
+	// and can't be reliably told apart by their first bytes
+	containers = map[string]string{
+		".mp4": "bmff", ".mov": "bmff", ".m4v": "bmff", ".3gp": "bmff", ".3g2": "bmff",
+		".heic": "heif", ".heif": "heif",
+		".mkv": "matroska", ".webm": "matroska",
+	}
+
+	quicktimeAtoms = map[string]bool{"moov": true, "mdat": true, "wide": true, "free": true, "skip": true, "pnot": true}
+
+	// nonMediaTypes are the MIME types, other than text, of files that are
+	// known not to hold media
+	nonMediaTypes = map[string]bool{
+		"application/pdf":              true,
+		"application/postscript":       true,
+		"application/zip":              true,
+		"application/x-gzip":           true,
+		"application/x-rar-compressed": true,
+		"application/wasm":             true,
+		"application/x-apple-ds-store": true,
+		"application/x-ole-storage":    true,
+	}
+
+	// heifBrands are the ISO base media file brands of HEIF images
+	heifBrands = map[string]string{
+		"heic": "image/heic", "heix": "image/heic", "heim": "image/heic", "heis": "image/heic",
+		"hevc": "image/heic-sequence", "hevx": "image/heic-sequence", "hevm": "image/heic-sequence", "hevs": "image/heic-sequence",
+		"mif1": "image/heif", "msf1": "image/heif-sequence",
+		"avif": "image/avif", "avis": "image/avif",
+	}
+)
+
+// typeList is a flag.Value holding a comma separated list of media types
+type typeList []MediaType
+
+func (tl *typeList) String() string {
+	types := []string{}
+	for _, t := range *tl {
+		types = append(types, string(t))
+	}
+	return strings.Join(types, ",")
+}
+
+func (tl *typeList) Set(str string) error {
+	types := typeList{}
+	for _, t := range strings.Split(str, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch MediaType(t) {
+		case Image, Video, Audio:
+			types = append(types, MediaType(t))
+		case "":
+		default:
+			return fmt.Errorf("unknown media type %q", t)
+		}
+	}
+	*tl = types
+	return nil
+}
+
+func (tl typeList) contains(mediaType MediaType) bool {
+	for _, t := range tl {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTypes changes the default media types that are processed.  Commands
+// call it so that -types defaults to the files their jobs can handle
+func SetTypes(types ...MediaType) {
+	TypesFlag = typeList(types)
+	Flags.Lookup("types").DefValue = TypesFlag.String()
+}
+
+// DetectContentType returns the MIME type of the data, which need be no
+// longer than the first 512 bytes of a file.  It extends
+// http.DetectContentType with the video and image formats written by
+// cameras and phones, "application/octet-stream" is returned when the
+// type is unknown
+func DetectContentType(data []byte) string {
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		return bmffType(data)
+	} else if len(data) >= 8 && quicktimeAtoms[string(data[4:8])] {
+		// QuickTime files written before ftyp existed
+		return "video/quicktime"
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return "image/tiff"
+	case bytes.HasPrefix(data, []byte("IIRO")), bytes.HasPrefix(data, []byte("IIRS")):
+		return "image/x-olympus-orf"
+	case bytes.HasPrefix(data, []byte("IIU\x00")):
+		return "image/x-panasonic-rw2"
+	case bytes.HasPrefix(data, []byte("FUJIFILMCCD-RAW")):
+		return "image/x-fuji-raf"
+	case bytes.HasPrefix(data, []byte("\x1a\x45\xdf\xa3")):
+		if bytes.Contains(data, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case bytes.HasPrefix(data, []byte("\x00\x00\x01\xba")):
+		return "video/mpeg"
+	case len(data) > 188 && data[0] == 0x47 && data[188] == 0x47:
+		return "video/mp2t"
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return "audio/flac"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "audio/ogg"
+	case len(data) >= 8 && string(data[4:8]) == "Bud1":
+		return "application/x-apple-ds-store"
+	case bytes.HasPrefix(data, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		// Thumbs.db and old Office documents
+		return "application/x-ole-storage"
+	}
+	return http.DetectContentType(data)
+}
+
+// bmffType returns the MIME type of an ISO base media file, such as an
+// mp4, mov or heic file, from the brands in its ftyp box
+func bmffType(data []byte) string {
+	brands := []string{string(data[8:12])}
+	size := int(binary.BigEndian.Uint32(data[0:4]))
+	for i := 16; i+4 <= size && i+4 <= len(data); i += 4 {
+		brands = append(brands, string(data[i:i+4]))
+	}
+
+	for _, brand := range brands {
+		if mimeType, found := heifBrands[brand]; found {
+			return mimeType
+		}
+	}
+
+	switch major := brands[0]; {
+	case major == "qt  ":
+		return "video/quicktime"
+	case major == "crx ":
+		return "image/x-canon-cr3"
+	case major == "M4A ", major == "M4B ":
+		return "audio/mp4"
+	case major == "M4V ", major == "M4VH", major == "M4VP":
+		return "video/x-m4v"
+	case strings.HasPrefix(major, "3gp"), strings.HasPrefix(major, "3g2"):
+		return "video/3gpp"
+	}
+	return "video/mp4"
+}
+
+// Sniff returns the MIME type of the file, detected from its content.
+// The file's extension is used for formats that can't be detected
+func Sniff(fs vfs.FileSystem, filename string) (string, error) {
+	file, err := fs.Open(filename)
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, data)
+	if closer, ok := file.(io.Closer); ok {
+		closer.Close()
+	}
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	mimeType := DetectContentType(data[:n])
+	if mimeType == "image/tiff" || mimeType == "application/octet-stream" {
+		if extType, found := extTypes[strings.ToLower(path.Ext(filename))]; found {
+			mimeType = extType
+		}
+	}
+	return mimeType, nil
+}
+
+// TypeOf returns the kind of media of the MIME type
+func TypeOf(mimeType string) MediaType {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return Image
+	case strings.HasPrefix(mimeType, "video/"):
+		return Video
+	case strings.HasPrefix(mimeType, "audio/"):
+		return Audio
+	}
+	return Other
+}
+
+// CanonicalExt returns the extension in lower case, with other spellings
+// such as .jpeg and .qt replaced by the usual one
+func CanonicalExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if canonical, found := canonicalExts[ext]; found {
+		return canonical
+	}
+	return ext
+}
+
+// CorrectExt returns the canonical extension for a file of the MIME type
+// that has the extension ext.  The extension is replaced when it is for a
+// different format, .png for a PNG named .jpg for instance, and kept when
+// the type has no single extension or shares a container with it
+func CorrectExt(ext, mimeType string) string {
+	ext = CanonicalExt(ext)
+	want := contentExts[mimeType]
+	if want == "" || want == ext || (containers[ext] != "" && containers[ext] == containers[want]) {
+		return ext
+	}
+	return want
+}
+
+// nonMedia determines if the MIME type is of a file that is known not to
+// hold media, such as text (including empty files), PDFs and archives
+func nonMedia(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || strings.HasPrefix(mimeType, "font/") || nonMediaTypes[mimeType]
+}
+
+// wanted reports whether the file should be given to the job.  Files
+// holding one of the media types in TypesFlag are, and so are sidecars and
+// files whose type isn't known, such as WMV or FLV videos, so that the
+// job can decide.  Only media of other types and files known not to be
+// media are skipped.  Files that can't be read are left for the job to report
+func wanted(fs vfs.FileSystem, filename string) bool {
+	if len(TypesFlag) == 0 || IsSidecar(filename) {
+		return true
+	}
+
+	mimeType, err := Sniff(fs, filename)
+	if err != nil {
+		return true
+	} else if mediaType := TypeOf(mimeType); mediaType != Other {
+		return TypesFlag.contains(mediaType)
+	}
+	return !nonMedia(mimeType)
+}
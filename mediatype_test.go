@@ -0,0 +1,228 @@
+package mediacleaner
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+)
+
+func ftyp(brands ...string) string {
+	box := ""
+	for i, brand := range brands {
+		box += brand
+		if i == 0 {
+			box += "\x00\x00\x00\x00"
+		}
+	}
+	return string([]byte{0, 0, 0, byte(8 + len(box))}) + "ftyp" + box
+}
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"jpeg", "\xff\xd8\xff\xe1\x00\x88Exif\x00\x00", "image/jpeg"},
+		{"png", "\x89PNG\x0d\x0a\x1a\x0a\x00\x00\x00\x0dIHDR", "image/png"},
+		{"tiff", "II*\x00\x08\x00\x00\x00", "image/tiff"},
+		{"orf", "IIRO\x08\x00\x00\x00", "image/x-olympus-orf"},
+		{"rw2", "IIU\x00\x08\x00\x00\x00", "image/x-panasonic-rw2"},
+		{"heic", ftyp("heic", "mif1", "heic"), "image/heic"},
+		{"heif", ftyp("mif1", "mif1"), "image/heif"},
+		{"cr3", ftyp("crx ", "crx ", "isom"), "image/x-canon-cr3"},
+		{"mp4", ftyp("isom", "isom", "mp41"), "video/mp4"},
+		{"mov", ftyp("qt  ", "qt  "), "video/quicktime"},
+		{"old mov", "\x00\x00\x00\x08wide\x00\x00\x00\x80moov", "video/quicktime"},
+		{"3gp", ftyp("3gp4", "isom", "3gp4"), "video/3gpp"},
+		{"m4a", ftyp("M4A ", "M4A ", "isom"), "audio/mp4"},
+		{"mkv", "\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x88matroska", "video/x-matroska"},
+		{"webm", "\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm", "video/webm"},
+		{"mp3", "ID3\x03\x00\x00\x00", "audio/mpeg"},
+		{"flac", "fLaC\x00\x00\x00\x22", "audio/flac"},
+		{"pdf", "%PDF-1.4\n", "application/pdf"},
+		{"text", "hello world\n", "text/plain; charset=utf-8"},
+		{"gzip", "\x1f\x8b\x08\x00", "application/x-gzip"},
+		{"unknown", "\x00\x01\x02\x03", "application/octet-stream"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := DetectContentType([]byte(test.input))
+			if test.want != got {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSniff(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+
+	tests := []struct {
+		filename string
+		content  string
+		want     string
+		wantType MediaType
+	}{
+		{"/a.jpg", "\xff\xd8\xff\xdb\x00\x84", "image/jpeg", Image},
+		{"/a.CR2", "II*\x00\x10\x00\x00\x00CR", "image/x-canon-cr2", Image},
+		{"/a.tif", "II*\x00\x08\x00\x00\x00", "image/tiff", Image},
+		{"/a.mts", "\x00\x00\x00\x00\x47\x40", "video/mp2t", Video},
+		{"/.DS_Store", "\x00\x00\x00\x01Bud1", "application/x-apple-ds-store", Other},
+		{"/Thumbs.db", "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage", Other},
+		{"/empty.jpg", "", "text/plain; charset=utf-8", Other},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			vfs.WriteFile(fs, test.filename, []byte(test.content), 0640)
+			got, err := Sniff(fs, test.filename)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if test.want != got {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+
+			if gotType := TypeOf(got); test.wantType != gotType {
+				t.Errorf("Wanted type %q got %q", test.wantType, gotType)
+			}
+		})
+	}
+
+	if _, err := Sniff(fs, "/missing.jpg"); err == nil {
+		t.Errorf("Wanted an error for a missing file")
+	}
+}
+
+func TestTypeList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    typeList
+		wantErr bool
+	}{
+		{"image", typeList{Image}, false},
+		{"Image, video,audio", typeList{Image, Video, Audio}, false},
+		{"", typeList{}, false},
+		{"pdf", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got := typeList{}
+			err := got.Set(test.input)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if !test.wantErr && !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestWalkTypes(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+	vfs.WriteFile(fs, "/a.jpg", []byte("\xff\xd8\xff\xdb\x00\x84"), 0640)
+	vfs.WriteFile(fs, "/b.mov", []byte(ftyp("qt  ", "qt  ")), 0640)
+	vfs.WriteFile(fs, "/.DS_Store", []byte("\x00\x00\x00\x01Bud1"), 0640)
+	vfs.WriteFile(fs, "/notes.txt", []byte("hello"), 0640)
+	vfs.WriteFile(fs, "/empty.jpg", nil, 0640)
+	vfs.WriteFile(fs, "/a.xmp", []byte("<?xml version=\"1.0\"?>\n<x:xmpmeta/>\n"), 0640)
+	vfs.WriteFile(fs, "/c.wmv", []byte("\x30\x26\xb2\x75\x8e\x66\xcf\x11"), 0640)
+	vfs.WriteFile(fs, "/d.mp3", []byte("ID3\x03\x00\x00\x00"), 0640)
+
+	oldTypes := TypesFlag
+	defer func() { TypesFlag = oldTypes }()
+
+	tests := []struct {
+		name  string
+		types typeList
+		want  []string
+	}{
+		{"all", typeList{}, []string{"/.DS_Store", "/a.jpg", "/a.xmp", "/b.mov", "/c.wmv", "/d.mp3", "/empty.jpg", "/notes.txt"}},
+		{"images", typeList{Image}, []string{"/a.jpg", "/a.xmp", "/c.wmv"}},
+		{"media", typeList{Image, Video}, []string{"/a.jpg", "/a.xmp", "/b.mov", "/c.wmv"}},
+		{"audio", typeList{Audio}, []string{"/a.xmp", "/c.wmv", "/d.mp3"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			TypesFlag = test.types
+			got := []string{}
+			walkFn := walk(fs, "", nil, func(fs vfs.FileSystem, filename string, root string) ContextJob {
+				got = append(got, filename)
+				return nil
+			})
+			vfs.Walk(fs, "/", func(filename string, info os.FileInfo, err error) error {
+				return walkFn(filename, info, err)
+			})
+
+			sort.Strings(got)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCanonicalExt(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{".JPEG", ".jpg"},
+		{".jpe", ".jpg"},
+		{".JPG", ".jpg"},
+		{".qt", ".mov"},
+		{".MOV", ".mov"},
+		{".tiff", ".tif"},
+		{".nef", ".nef"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if got := CanonicalExt(test.input); test.want != got {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCorrectExt(t *testing.T) {
+	tests := []struct {
+		ext      string
+		mimeType string
+		want     string
+	}{
+		{".jpg", "image/png", ".png"},
+		{".JPEG", "image/jpeg", ".jpg"},
+		{".jpg", "image/heic", ".heic"},
+		{".heif", "image/heic", ".heif"},
+		{".qt", "video/quicktime", ".mov"},
+		{".mp4", "video/quicktime", ".mp4"},
+		{".3gp", "video/mp4", ".3gp"},
+		{".mov", "image/jpeg", ".jpg"},
+		{".nef", "image/tiff", ".nef"},
+		{".dng", "image/x-adobe-dng", ".dng"},
+		{"", "video/mp4", ".mp4"},
+		{".txt", "text/plain; charset=utf-8", ".txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ext+" "+test.mimeType, func(t *testing.T) {
+			if got := CorrectExt(test.ext, test.mimeType); test.want != got {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package mediacleaner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+// ErrInPipeline indicates that the file was created by a pipeline that is
+// still working on it, so the pipeline started for its create event is skipped
+var ErrInPipeline = errors.New("file is being processed by another pipeline")
+
+// Mover is implemented by jobs that move or replace their file, such as
+// renaming it or transcoding it to a new format.  Moved returns the file's
+// name, relative to the root, once the job has executed
+type Mover interface {
+	Moved() string
+}
+
+// Pipeline chains the jobs created by each of the stages.  Every file is
+// given to the stages in order and when a stage's job is a Mover the
+// following stages are given the file's new name.  A stage whose check fails
+// with a CheckError is skipped, any other error stops the pipeline.  Check
+// and execute timeouts apply to each stage
+func Pipeline(stages ...ContextFileCallback) ContextFileCallback {
+	claims := &claims{files: make(map[string]int)}
+	return func(fs vfs.FileSystem, filename string, root string) ContextJob {
+		return &pipelineJob{fs: fs, root: root, filename: filename, stages: stages, claims: claims}
+	}
+}
+
+// claimHold is how long a file stays claimed after its pipeline has
+// finished.  The watch event for the file's creation is only acted on once
+// the file has settled, so the claim is held for the settle period and the
+// time it takes to notice, and a moment more for the job to be checked
+var claimHold = func() time.Duration {
+	return SettleFlag + SettleFlag/4 + time.Second
+}
+
+// claims are the names of the files pipelines have moved and are still
+// working on.  Creating them triggers watch events that would otherwise
+// start a second pipeline for the same file
+type claims struct {
+	mu    sync.Mutex
+	files map[string]int
+}
+
+func (c *claims) add(filename string) {
+	c.mu.Lock()
+	c.files[filename]++
+	c.mu.Unlock()
+}
+
+func (c *claims) remove(filename string) {
+	c.mu.Lock()
+	if c.files[filename]--; c.files[filename] <= 0 {
+		delete(c.files, filename)
+	}
+	c.mu.Unlock()
+}
+
+// release removes the claim once claimHold has passed
+func (c *claims) release(filename string) {
+	time.AfterFunc(claimHold(), func() { c.remove(filename) })
+}
+
+func (c *claims) claimed(filename string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.files[filename] > 0
+}
+
+type pipelineJob struct {
+	fs       vfs.FileSystem
+	root     string
+	filename string
+	stages   []ContextFileCallback
+	claims   *claims
+}
+
+func (pj *pipelineJob) Name() string { return pj.filename }
+
+// TimeLimits only limits the pipeline's check, the execution of each stage
+// is timed on its own, using the stage job's limits when it is a TimeLimiter
+func (pj *pipelineJob) TimeLimits() (check, execute time.Duration) {
+	return CheckTimeout, 0
+}
+
+func (pj *pipelineJob) Check(ctx context.Context) error {
+	if pj.claims.claimed(pj.filename) {
+		return &CheckError{Cause: ErrInPipeline}
+	}
+	return nil
+}
+
+func (pj *pipelineJob) Execute(ctx context.Context) error {
+	filename := pj.filename
+	for _, stage := range pj.stages {
+		job := stage(pj.fs, filename, pj.root)
+		if job == nil {
+			continue
+		}
+
+		check, execute := CheckTimeout, ExecuteTimeout
+		if limiter, ok := job.(TimeLimiter); ok {
+			check, execute = limiter.TimeLimits()
+		}
+
+		ce := &CheckError{}
+		err := withTimeout(ctx, check, job.Check)
+		if errors.As(err, &ce) {
+			Infof("Skipping %s: %v", job.Name(), errors.Unwrap(err))
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = withTimeout(ctx, execute, job.Execute)
+		if err != nil {
+			return err
+		}
+
+		if mover, ok := job.(Mover); ok && mover.Moved() != filename {
+			filename = mover.Moved()
+			pj.claims.add(filename)
+			defer pj.claims.release(filename)
+		}
+	}
+	return nil
+}
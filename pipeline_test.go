@@ -0,0 +1,200 @@
+package mediacleaner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+// moveJob records the files it was given and, when moveTo
+// is set, moves the file there
+type moveJob struct {
+	testJob
+	moveTo string
+}
+
+func (mj *moveJob) Moved() string {
+	if mj.execute && mj.moveTo != "" {
+		return mj.moveTo
+	}
+	return mj.name
+}
+
+func TestPipeline(t *testing.T) {
+	oldLogger := Logger
+	Logger = log.New(ioutil.Discard, "", 0)
+	defer func() { Logger = oldLogger }()
+
+	checkErr := errors.New("check failed")
+	type stage struct {
+		moveTo   string
+		checkErr error
+		noJob    bool
+	}
+
+	tests := []struct {
+		name    string
+		stages  []stage
+		want    []string
+		wantErr error
+	}{
+		{"new name passed on", []stage{{moveTo: "/b"}, {}, {}}, []string{"/a", "/b", "/b"}, nil},
+		{"skipped stage", []stage{{checkErr: &CheckError{Cause: ErrUnknownDateFormat}}, {moveTo: "/c"}, {}}, []string{"", "/a", "/c"}, nil},
+		{"no job", []stage{{noJob: true}, {}}, []string{"", "/a"}, nil},
+		{"check error", []stage{{}, {checkErr: checkErr}, {}}, []string{"/a", "", ""}, checkErr},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jobs := []*moveJob{}
+			callbacks := []ContextFileCallback{}
+			for _, s := range test.stages {
+				s := s
+				job := &moveJob{testJob: testJob{checkErr: s.checkErr}, moveTo: s.moveTo}
+				jobs = append(jobs, job)
+				callbacks = append(callbacks, func(fs vfs.FileSystem, filename string, root string) ContextJob {
+					if s.noJob {
+						return nil
+					}
+					job.name = filename
+					return job
+				})
+			}
+
+			job := Pipeline(callbacks...)(nil, "/a", "")
+			err := job.Check(context.Background())
+			if err == nil {
+				err = job.Execute(context.Background())
+			}
+
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			got := []string{}
+			for _, job := range jobs {
+				if job.execute {
+					got = append(got, job.name)
+				} else {
+					got = append(got, "")
+				}
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted executed files %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+// claimJob checks whether a pipeline for its file would run while it executes
+type claimJob struct {
+	testJob
+	pipeline ContextFileCallback
+	claimed  error
+}
+
+func (cj *claimJob) Execute(ctx context.Context) error {
+	cj.claimed = cj.pipeline(nil, "/b", "").Check(ctx)
+	return cj.testJob.Execute(ctx)
+}
+
+func TestPipelineClaims(t *testing.T) {
+	oldHold := claimHold
+	claimHold = func() time.Duration { return 50 * time.Millisecond }
+	defer func() { claimHold = oldHold }()
+
+	check := &claimJob{}
+	pipeline := Pipeline(
+		func(fs vfs.FileSystem, filename string, root string) ContextJob {
+			return &moveJob{testJob: testJob{name: filename}, moveTo: "/b"}
+		},
+		func(fs vfs.FileSystem, filename string, root string) ContextJob {
+			return check
+		},
+	)
+	check.pipeline = pipeline
+
+	job := pipeline(nil, "/a", "")
+	if err := job.Execute(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !errors.Is(check.claimed, ErrInPipeline) {
+		t.Errorf("Wanted %v while the pipeline was running got %v", ErrInPipeline, check.claimed)
+	}
+
+	// the create event for /b is acted on after the file settles
+	if err := pipeline(nil, "/b", "").Check(context.Background()); !errors.Is(err, ErrInPipeline) {
+		t.Errorf("Wanted %v until the claim is released got %v", ErrInPipeline, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if err := pipeline(nil, "/b", "").Check(context.Background()); err != nil {
+		t.Errorf("Wanted the claim to be released, got %v", err)
+	}
+}
+
+// limitJob waits for its context to be done, or for a second, when it
+// executes
+type limitJob struct {
+	testJob
+}
+
+func (lj *limitJob) TimeLimits() (check, execute time.Duration) {
+	return 0, 20 * time.Millisecond
+}
+
+func (lj *limitJob) Execute(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// unlimitedJob hides the limits of a limitJob
+type unlimitedJob struct {
+	ContextJob
+}
+
+func TestPipelineTimeLimits(t *testing.T) {
+	oldTimeout := ExecuteTimeout
+	ExecuteTimeout = 100 * time.Millisecond
+	defer func() { ExecuteTimeout = oldTimeout }()
+
+	tests := []struct {
+		name    string
+		job     ContextJob
+		wantErr error
+		wantMax time.Duration
+	}{
+		{"stage limits", &limitJob{}, context.DeadlineExceeded, 80 * time.Millisecond},
+		{"default limits", &unlimitedJob{&limitJob{}}, context.DeadlineExceeded, 500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := Pipeline(func(fs vfs.FileSystem, filename string, root string) ContextJob {
+				return test.job
+			})(nil, "/a", "")
+
+			start := time.Now()
+			err := job.Execute(context.Background())
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if elapsed := time.Since(start); elapsed > test.wantMax {
+				t.Errorf("Wanted the stage to time out within %v, took %v", test.wantMax, elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package mediacleaner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoGPS indicates that a GPS position could not be found or parsed
+	ErrNoGPS = errors.New("no GPS position")
+
+	// gpsCoordinate matches the coordinates printed by exiftool, such as
+	// 48 deg 51' 24.00" N
+	gpsCoordinate = regexp.MustCompile(`^(\d+(?:\.\d+)?) deg (\d+(?:\.\d+)?)' (\d+(?:\.\d+)?)" ?([NSEW])$`)
+)
+
+// earthRadius is the mean radius of the Earth in kilometers
+const earthRadius = 6371.0
+
+// Place is a named location, such as a city, from an offline gazetteer
+type Place struct {
+	Name      string
+	Country   string
+	Latitude  float64
+	Longitude float64
+}
+
+// Places is a list of places that can be searched by coordinates
+type Places []Place
+
+// LoadPlaces reads places in the GeoNames tab separated format, as found
+// in the cities500.txt, cities1000.txt, cities5000.txt and cities15000.txt
+// dumps from https://download.geonames.org/export/dump/.  The ASCII name
+// (column 3) is used so that place names are safe for filenames
+func LoadPlaces(reader io.Reader) (Places, error) {
+	places := Places{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) < 9 {
+			return places, fmt.Errorf("line %d: expected at least 9 fields got %d", line, len(fields))
+		}
+
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return places, fmt.Errorf("line %d: invalid latitude %q", line, fields[4])
+		}
+
+		lon, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return places, fmt.Errorf("line %d: invalid longitude %q", line, fields[5])
+		}
+
+		name := fields[2]
+		if name == "" {
+			name = fields[1]
+		}
+		places = append(places, Place{Name: name, Country: fields[8], Latitude: lat, Longitude: lon})
+	}
+	return places, scanner.Err()
+}
+
+// Distance returns the great circle distance, in kilometers, between
+// two coordinates
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Nearest finds the place closest to the coordinates.  If no place is within
+// maxDistance kilometers then found is false.  A maxDistance of zero or less
+// means any distance
+func (places Places) Nearest(lat, lon, maxDistance float64) (place Place, found bool) {
+	best := math.Inf(1)
+	for _, p := range places {
+		// the latitude difference alone is a cheap lower bound
+		// on the distance, skip places that can't be closer
+		if math.Abs(p.Latitude-lat)*math.Pi/180*earthRadius > best {
+			continue
+		}
+
+		if d := Distance(lat, lon, p.Latitude, p.Longitude); d < best {
+			best = d
+			place = p
+		}
+	}
+	found = len(places) > 0 && (maxDistance <= 0 || best <= maxDistance)
+	return place, found
+}
+
+// ParseGPSCoordinate converts a coordinate printed by exiftool, such as
+// 48 deg 51' 24.00" N, into decimal degrees.  Plain decimal degrees, as
+// printed with exiftool's -n option, are accepted as well
+func ParseGPSCoordinate(str string) (float64, error) {
+	str = strings.TrimSpace(str)
+	if value, err := strconv.ParseFloat(str, 64); err == nil {
+		return value, nil
+	}
+
+	matches := gpsCoordinate.FindStringSubmatch(str)
+	if matches == nil {
+		return 0, ErrNoGPS
+	}
+
+	deg, _ := strconv.ParseFloat(matches[1], 64)
+	min, _ := strconv.ParseFloat(matches[2], 64)
+	sec, _ := strconv.ParseFloat(matches[3], 64)
+	value := deg + min/60 + sec/3600
+	if matches[4] == "S" || matches[4] == "W" {
+		value = -value
+	}
+	return value, nil
+}
+
+// ParseGPSPosition converts exiftool's GPS Position, a latitude
+// and longitude separated by a comma, into decimal degrees
+func ParseGPSPosition(str string) (lat, lon float64, err error) {
+	fields := strings.Split(str, ",")
+	if len(fields) != 2 {
+		return 0, 0, ErrNoGPS
+	}
+
+	lat, err = ParseGPSCoordinate(fields[0])
+	if err == nil {
+		lon, err = ParseGPSCoordinate(fields[1])
+	}
+	return lat, lon, err
+}
@@ -0,0 +1,358 @@
+package mediacleaner
+
+// DefaultPlaces is a small offline dataset of the world's capitals and
+// large cities, used when a GeoNames cities file isn't given.  Names are
+// ASCII, the same as the names LoadPlaces reads
+var DefaultPlaces = Places{
+	// Europe
+	{"Amsterdam", "NL", 52.37403, 4.88969},
+	{"Rotterdam", "NL", 51.9225, 4.47917},
+	{"Brussels", "BE", 50.85045, 4.34878},
+	{"Antwerp", "BE", 51.21989, 4.40346},
+	{"Luxembourg", "LU", 49.61167, 6.13},
+	{"Paris", "FR", 48.85341, 2.3488},
+	{"Lyon", "FR", 45.74846, 4.84671},
+	{"Marseille", "FR", 43.29695, 5.38107},
+	{"Nice", "FR", 43.70313, 7.26608},
+	{"Toulouse", "FR", 43.60426, 1.44367},
+	{"Bordeaux", "FR", 44.84044, -0.5805},
+	{"Strasbourg", "FR", 48.58392, 7.74553},
+	{"Nantes", "FR", 47.21725, -1.55336},
+	{"Lille", "FR", 50.63297, 3.05858},
+	{"Monaco", "MC", 43.73333, 7.41667},
+	{"London", "GB", 51.50853, -0.12574},
+	{"Manchester", "GB", 53.48095, -2.23743},
+	{"Birmingham", "GB", 52.48142, -1.89983},
+	{"Liverpool", "GB", 53.41058, -2.97794},
+	{"Leeds", "GB", 53.79648, -1.54785},
+	{"Bristol", "GB", 51.45523, -2.59665},
+	{"Edinburgh", "GB", 55.95206, -3.19648},
+	{"Glasgow", "GB", 55.86515, -4.25763},
+	{"Cardiff", "GB", 51.48, -3.18},
+	{"Belfast", "GB", 54.59682, -5.92541},
+	{"Dublin", "IE", 53.33306, -6.24889},
+	{"Cork", "IE", 51.89797, -8.47061},
+	{"Reykjavik", "IS", 64.13548, -21.89541},
+	{"Oslo", "NO", 59.91273, 10.74609},
+	{"Bergen", "NO", 60.39299, 5.32415},
+	{"Stockholm", "SE", 59.32938, 18.06871},
+	{"Gothenburg", "SE", 57.70716, 11.96679},
+	{"Copenhagen", "DK", 55.67594, 12.56553},
+	{"Helsinki", "FI", 60.16952, 24.93545},
+	{"Tallinn", "EE", 59.43696, 24.75353},
+	{"Riga", "LV", 56.946, 24.10589},
+	{"Vilnius", "LT", 54.68916, 25.2798},
+	{"Berlin", "DE", 52.52437, 13.41053},
+	{"Hamburg", "DE", 53.57532, 10.01534},
+	{"Munich", "DE", 48.13743, 11.57549},
+	{"Cologne", "DE", 50.93333, 6.95},
+	{"Frankfurt am Main", "DE", 50.11552, 8.68417},
+	{"Stuttgart", "DE", 48.78232, 9.17702},
+	{"Dusseldorf", "DE", 51.22172, 6.77616},
+	{"Dresden", "DE", 51.05089, 13.73832},
+	{"Leipzig", "DE", 51.33962, 12.37129},
+	{"Vienna", "AT", 48.20849, 16.37208},
+	{"Salzburg", "AT", 47.79941, 13.04399},
+	{"Innsbruck", "AT", 47.26266, 11.39454},
+	{"Zurich", "CH", 47.36667, 8.55},
+	{"Geneva", "CH", 46.20222, 6.14569},
+	{"Bern", "CH", 46.94809, 7.44744},
+	{"Basel", "CH", 47.55839, 7.57327},
+	{"Prague", "CZ", 50.08804, 14.42076},
+	{"Bratislava", "SK", 48.14816, 17.10674},
+	{"Budapest", "HU", 47.49835, 19.04045},
+	{"Warsaw", "PL", 52.22977, 21.01178},
+	{"Krakow", "PL", 50.06143, 19.93658},
+	{"Gdansk", "PL", 54.35205, 18.64637},
+	{"Ljubljana", "SI", 46.05108, 14.50513},
+	{"Zagreb", "HR", 45.81444, 15.97798},
+	{"Split", "HR", 43.50891, 16.43915},
+	{"Dubrovnik", "HR", 42.64807, 18.09216},
+	{"Sarajevo", "BA", 43.84864, 18.35644},
+	{"Belgrade", "RS", 44.80401, 20.46513},
+	{"Podgorica", "ME", 42.44111, 19.26361},
+	{"Tirana", "AL", 41.3275, 19.81889},
+	{"Skopje", "MK", 41.99646, 21.43141},
+	{"Sofia", "BG", 42.69751, 23.32415},
+	{"Bucharest", "RO", 44.43225, 26.10626},
+	{"Chisinau", "MD", 47.00556, 28.8575},
+	{"Kyiv", "UA", 50.45466, 30.5238},
+	{"Lviv", "UA", 49.83826, 24.02324},
+	{"Odesa", "UA", 46.47747, 30.73262},
+	{"Minsk", "BY", 53.9, 27.56667},
+	{"Moscow", "RU", 55.75222, 37.61556},
+	{"Saint Petersburg", "RU", 59.93863, 30.31413},
+	{"Athens", "GR", 37.98376, 23.72784},
+	{"Thessaloniki", "GR", 40.64361, 22.93086},
+	{"Istanbul", "TR", 41.01384, 28.94966},
+	{"Ankara", "TR", 39.91987, 32.85427},
+	{"Izmir", "TR", 38.41273, 27.13838},
+	{"Antalya", "TR", 36.90812, 30.69556},
+	{"Nicosia", "CY", 35.17531, 33.3642},
+	{"Valletta", "MT", 35.89968, 14.5148},
+	{"Rome", "IT", 41.89193, 12.51133},
+	{"Milan", "IT", 45.46427, 9.18951},
+	{"Naples", "IT", 40.85216, 14.26811},
+	{"Turin", "IT", 45.07049, 7.68682},
+	{"Florence", "IT", 43.77925, 11.24626},
+	{"Venice", "IT", 45.43713, 12.33265},
+	{"Bologna", "IT", 44.49381, 11.33875},
+	{"Palermo", "IT", 38.13205, 13.33561},
+	{"Madrid", "ES", 40.4165, -3.70256},
+	{"Barcelona", "ES", 41.38879, 2.15899},
+	{"Valencia", "ES", 39.46975, -0.37739},
+	{"Seville", "ES", 37.38283, -5.97317},
+	{"Malaga", "ES", 36.72016, -4.42034},
+	{"Bilbao", "ES", 43.26271, -2.92528},
+	{"Palma", "ES", 39.56939, 2.65024},
+	{"Las Palmas", "ES", 28.09973, -15.41343},
+	{"Lisbon", "PT", 38.71667, -9.13333},
+	{"Porto", "PT", 41.14961, -8.61099},
+	{"Funchal", "PT", 32.66568, -16.92547},
+	{"Andorra la Vella", "AD", 42.50779, 1.52109},
+
+	// Africa
+	{"Cairo", "EG", 30.06263, 31.24967},
+	{"Alexandria", "EG", 31.20176, 29.91582},
+	{"Luxor", "EG", 25.69893, 32.6421},
+	{"Tunis", "TN", 36.81897, 10.16579},
+	{"Algiers", "DZ", 36.7525, 3.04197},
+	{"Rabat", "MA", 34.01325, -6.83255},
+	{"Casablanca", "MA", 33.58831, -7.61138},
+	{"Marrakesh", "MA", 31.63416, -7.99994},
+	{"Fes", "MA", 34.03313, -5.00028},
+	{"Tripoli", "LY", 32.88743, 13.18733},
+	{"Khartoum", "SD", 15.55177, 32.53241},
+	{"Addis Ababa", "ET", 9.02497, 38.74689},
+	{"Nairobi", "KE", -1.28333, 36.81667},
+	{"Mombasa", "KE", -4.05466, 39.66359},
+	{"Kampala", "UG", 0.31628, 32.58219},
+	{"Kigali", "RW", -1.94995, 30.05885},
+	{"Dar es Salaam", "TZ", -6.82349, 39.26951},
+	{"Zanzibar", "TZ", -6.16394, 39.19793},
+	{"Arusha", "TZ", -3.36667, 36.68333},
+	{"Lagos", "NG", 6.45407, 3.39467},
+	{"Abuja", "NG", 9.05785, 7.49508},
+	{"Accra", "GH", 5.55602, -0.1969},
+	{"Abidjan", "CI", 5.30966, -4.01266},
+	{"Dakar", "SN", 14.6937, -17.44406},
+	{"Bamako", "ML", 12.65, -8},
+	{"Kinshasa", "CD", -4.32758, 15.31357},
+	{"Luanda", "AO", -8.83682, 13.23432},
+	{"Lusaka", "ZM", -15.40669, 28.28713},
+	{"Harare", "ZW", -17.82772, 31.05337},
+	{"Victoria Falls", "ZW", -17.93285, 25.83066},
+	{"Maputo", "MZ", -25.96553, 32.58322},
+	{"Windhoek", "NA", -22.55941, 17.08323},
+	{"Gaborone", "BW", -24.65451, 25.90859},
+	{"Johannesburg", "ZA", -26.20227, 28.04363},
+	{"Pretoria", "ZA", -25.74486, 28.18783},
+	{"Cape Town", "ZA", -33.92584, 18.42322},
+	{"Durban", "ZA", -29.8579, 31.0292},
+	{"Antananarivo", "MG", -18.91368, 47.53613},
+	{"Port Louis", "MU", -20.16194, 57.49889},
+	{"Victoria", "SC", -4.61667, 55.45},
+
+	// Middle East and Asia
+	{"Jerusalem", "IL", 31.76904, 35.21633},
+	{"Tel Aviv", "IL", 32.08088, 34.78057},
+	{"Amman", "JO", 31.95522, 35.94503},
+	{"Petra", "JO", 30.32096, 35.47908},
+	{"Beirut", "LB", 33.89332, 35.50157},
+	{"Damascus", "SY", 33.5102, 36.29128},
+	{"Baghdad", "IQ", 33.34058, 44.40088},
+	{"Tehran", "IR", 35.69439, 51.42151},
+	{"Isfahan", "IR", 32.65246, 51.67462},
+	{"Riyadh", "SA", 24.68773, 46.72185},
+	{"Jeddah", "SA", 21.49012, 39.18624},
+	{"Mecca", "SA", 21.42664, 39.82563},
+	{"Kuwait City", "KW", 29.36972, 47.97833},
+	{"Manama", "BH", 26.22787, 50.58565},
+	{"Doha", "QA", 25.28545, 51.53096},
+	{"Abu Dhabi", "AE", 24.45118, 54.39696},
+	{"Dubai", "AE", 25.07725, 55.30927},
+	{"Muscat", "OM", 23.58413, 58.40778},
+	{"Sanaa", "YE", 15.35472, 44.20667},
+	{"Tbilisi", "GE", 41.69411, 44.83368},
+	{"Yerevan", "AM", 40.18111, 44.51361},
+	{"Baku", "AZ", 40.37767, 49.89201},
+	{"Tashkent", "UZ", 41.26465, 69.21627},
+	{"Samarkand", "UZ", 39.65417, 66.95972},
+	{"Almaty", "KZ", 43.25, 76.91667},
+	{"Astana", "KZ", 51.1801, 71.44598},
+	{"Bishkek", "KG", 42.87, 74.59},
+	{"Kabul", "AF", 34.52813, 69.17233},
+	{"Islamabad", "PK", 33.72148, 73.04329},
+	{"Karachi", "PK", 24.8608, 67.0104},
+	{"Lahore", "PK", 31.558, 74.35071},
+	{"New Delhi", "IN", 28.63576, 77.22445},
+	{"Mumbai", "IN", 19.07283, 72.88261},
+	{"Bengaluru", "IN", 12.97194, 77.59369},
+	{"Kolkata", "IN", 22.56263, 88.36304},
+	{"Chennai", "IN", 13.08784, 80.27847},
+	{"Hyderabad", "IN", 17.38405, 78.45636},
+	{"Jaipur", "IN", 26.91962, 75.78781},
+	{"Agra", "IN", 27.18333, 78.01667},
+	{"Goa", "IN", 15.49574, 73.82624},
+	{"Kathmandu", "NP", 27.70169, 85.3206},
+	{"Thimphu", "BT", 27.46609, 89.64191},
+	{"Dhaka", "BD", 23.7104, 90.40744},
+	{"Colombo", "LK", 6.93548, 79.84868},
+	{"Male", "MV", 4.1748, 73.50888},
+	{"Yangon", "MM", 16.80528, 96.15611},
+	{"Bangkok", "TH", 13.75398, 100.50144},
+	{"Chiang Mai", "TH", 18.79038, 98.98468},
+	{"Phuket", "TH", 7.89059, 98.3981},
+	{"Vientiane", "LA", 17.96667, 102.6},
+	{"Phnom Penh", "KH", 11.56245, 104.91601},
+	{"Siem Reap", "KH", 13.36179, 103.86056},
+	{"Hanoi", "VN", 21.0245, 105.84117},
+	{"Ho Chi Minh City", "VN", 10.82302, 106.62965},
+	{"Da Nang", "VN", 16.06778, 108.22083},
+	{"Kuala Lumpur", "MY", 3.1412, 101.68653},
+	{"Singapore", "SG", 1.28967, 103.85007},
+	{"Jakarta", "ID", -6.21462, 106.84513},
+	{"Denpasar", "ID", -8.65, 115.21667},
+	{"Yogyakarta", "ID", -7.80139, 110.36472},
+	{"Manila", "PH", 14.6042, 120.9822},
+	{"Cebu City", "PH", 10.31672, 123.89071},
+	{"Beijing", "CN", 39.9075, 116.39723},
+	{"Shanghai", "CN", 31.22222, 121.45806},
+	{"Guangzhou", "CN", 23.11667, 113.25},
+	{"Shenzhen", "CN", 22.54554, 114.0683},
+	{"Chengdu", "CN", 30.66667, 104.06667},
+	{"Xi'an", "CN", 34.25833, 108.92861},
+	{"Hangzhou", "CN", 30.29365, 120.16142},
+	{"Hong Kong", "HK", 22.27832, 114.17469},
+	{"Macau", "MO", 22.20056, 113.54611},
+	{"Taipei", "TW", 25.04776, 121.53185},
+	{"Ulaanbaatar", "MN", 47.90771, 106.88324},
+	{"Seoul", "KR", 37.566, 126.9784},
+	{"Busan", "KR", 35.10168, 129.03004},
+	{"Pyongyang", "KP", 39.03385, 125.75432},
+	{"Tokyo", "JP", 35.6895, 139.69171},
+	{"Yokohama", "JP", 35.44778, 139.6425},
+	{"Osaka", "JP", 34.69374, 135.50218},
+	{"Kyoto", "JP", 35.02107, 135.75385},
+	{"Nagoya", "JP", 35.18147, 136.90641},
+	{"Sapporo", "JP", 43.06667, 141.35},
+	{"Fukuoka", "JP", 33.6, 130.41667},
+	{"Hiroshima", "JP", 34.4, 132.45},
+	{"Naha", "JP", 26.2125, 127.68111},
+
+	// Oceania
+	{"Sydney", "AU", -33.86785, 151.20732},
+	{"Melbourne", "AU", -37.814, 144.96332},
+	{"Brisbane", "AU", -27.46794, 153.02809},
+	{"Perth", "AU", -31.95224, 115.8614},
+	{"Adelaide", "AU", -34.92866, 138.59863},
+	{"Canberra", "AU", -35.28346, 149.12807},
+	{"Hobart", "AU", -42.87936, 147.32941},
+	{"Darwin", "AU", -12.46113, 130.84185},
+	{"Cairns", "AU", -16.92366, 145.76613},
+	{"Gold Coast", "AU", -28.00029, 153.43088},
+	{"Auckland", "NZ", -36.84853, 174.76349},
+	{"Wellington", "NZ", -41.28664, 174.77557},
+	{"Christchurch", "NZ", -43.53333, 172.63333},
+	{"Queenstown", "NZ", -45.03023, 168.66271},
+	{"Suva", "FJ", -18.14161, 178.44149},
+	{"Nadi", "FJ", -17.80309, 177.41617},
+	{"Papeete", "PF", -17.53733, -149.5665},
+	{"Noumea", "NC", -22.27631, 166.4572},
+	{"Port Moresby", "PG", -9.44314, 147.17972},
+	{"Apia", "WS", -13.83333, -171.76666},
+
+	// North America
+	{"New York City", "US", 40.71427, -74.00597},
+	{"Boston", "US", 42.35843, -71.05977},
+	{"Philadelphia", "US", 39.95233, -75.16379},
+	{"Washington", "US", 38.89511, -77.03637},
+	{"Baltimore", "US", 39.29038, -76.61219},
+	{"Pittsburgh", "US", 40.44062, -79.99589},
+	{"Atlanta", "US", 33.749, -84.38798},
+	{"Charlotte", "US", 35.22709, -80.84313},
+	{"Nashville", "US", 36.16589, -86.78444},
+	{"Miami", "US", 25.77427, -80.19366},
+	{"Orlando", "US", 28.53834, -81.37924},
+	{"Tampa", "US", 27.94752, -82.45843},
+	{"New Orleans", "US", 29.95465, -90.07507},
+	{"Chicago", "US", 41.85003, -87.65005},
+	{"Detroit", "US", 42.33143, -83.04575},
+	{"Cleveland", "US", 41.4995, -81.69541},
+	{"Minneapolis", "US", 44.97997, -93.26384},
+	{"St. Louis", "US", 38.62727, -90.19789},
+	{"Kansas City", "US", 39.09973, -94.57857},
+	{"Dallas", "US", 32.78306, -96.80667},
+	{"Houston", "US", 29.76328, -95.36327},
+	{"Austin", "US", 30.26715, -97.74306},
+	{"San Antonio", "US", 29.42412, -98.49363},
+	{"Denver", "US", 39.73915, -104.9847},
+	{"Salt Lake City", "US", 40.76078, -111.89105},
+	{"Phoenix", "US", 33.44838, -112.07404},
+	{"Las Vegas", "US", 36.17497, -115.13722},
+	{"Los Angeles", "US", 34.05223, -118.24368},
+	{"San Diego", "US", 32.71571, -117.16472},
+	{"San Francisco", "US", 37.77493, -122.41942},
+	{"San Jose", "US", 37.33939, -121.89496},
+	{"Sacramento", "US", 38.58157, -121.4944},
+	{"Portland", "US", 45.52345, -122.67621},
+	{"Seattle", "US", 47.60621, -122.33207},
+	{"Anchorage", "US", 61.21806, -149.90028},
+	{"Honolulu", "US", 21.30694, -157.85833},
+	{"Toronto", "CA", 43.70011, -79.4163},
+	{"Montreal", "CA", 45.50884, -73.58781},
+	{"Ottawa", "CA", 45.41117, -75.69812},
+	{"Quebec", "CA", 46.81228, -71.21454},
+	{"Vancouver", "CA", 49.24966, -123.11934},
+	{"Calgary", "CA", 51.05011, -114.08529},
+	{"Edmonton", "CA", 53.55014, -113.46871},
+	{"Winnipeg", "CA", 49.8844, -97.14704},
+	{"Halifax", "CA", 44.64533, -63.57239},
+	{"Mexico City", "MX", 19.42847, -99.12766},
+	{"Guadalajara", "MX", 20.66682, -103.39182},
+	{"Monterrey", "MX", 25.67507, -100.31847},
+	{"Cancun", "MX", 21.17429, -86.84656},
+	{"Oaxaca", "MX", 17.06542, -96.72365},
+	{"Havana", "CU", 23.13302, -82.38304},
+	{"Kingston", "JM", 17.99702, -76.79358},
+	{"Santo Domingo", "DO", 18.47186, -69.89232},
+	{"San Juan", "PR", 18.46633, -66.10572},
+	{"Nassau", "BS", 25.05823, -77.34306},
+	{"Guatemala City", "GT", 14.64072, -90.51327},
+	{"San Salvador", "SV", 13.68935, -89.18718},
+	{"Tegucigalpa", "HN", 14.0818, -87.20681},
+	{"Managua", "NI", 12.13282, -86.2504},
+	{"San Jose", "CR", 9.93333, -84.08333},
+	{"Panama City", "PA", 8.9936, -79.51973},
+
+	// South America
+	{"Bogota", "CO", 4.60971, -74.08175},
+	{"Medellin", "CO", 6.25184, -75.56359},
+	{"Cartagena", "CO", 10.39972, -75.51444},
+	{"Caracas", "VE", 10.48801, -66.87919},
+	{"Quito", "EC", -0.22985, -78.52495},
+	{"Guayaquil", "EC", -2.19616, -79.88621},
+	{"Lima", "PE", -12.04318, -77.02824},
+	{"Cusco", "PE", -13.52264, -71.96734},
+	{"La Paz", "BO", -16.5, -68.15},
+	{"Santiago", "CL", -33.45694, -70.64827},
+	{"Valparaiso", "CL", -33.03932, -71.62725},
+	{"Buenos Aires", "AR", -34.61315, -58.37723},
+	{"Cordoba", "AR", -31.4135, -64.18105},
+	{"Mendoza", "AR", -32.89084, -68.82717},
+	{"Bariloche", "AR", -41.14557, -71.30822},
+	{"Ushuaia", "AR", -54.8, -68.3},
+	{"Montevideo", "UY", -34.90328, -56.18816},
+	{"Asuncion", "PY", -25.28646, -57.647},
+	{"Sao Paulo", "BR", -23.5475, -46.63611},
+	{"Rio de Janeiro", "BR", -22.90642, -43.18223},
+	{"Brasilia", "BR", -15.77972, -47.92972},
+	{"Salvador", "BR", -12.97111, -38.51083},
+	{"Belo Horizonte", "BR", -19.92083, -43.93778},
+	{"Recife", "BR", -8.05389, -34.88111},
+	{"Fortaleza", "BR", -3.71722, -38.54306},
+	{"Manaus", "BR", -3.10194, -60.025},
+	{"Curitiba", "BR", -25.42778, -49.27306},
+	{"Porto Alegre", "BR", -30.03306, -51.23},
+	{"Florianopolis", "BR", -27.59667, -48.54917},
+}
@@ -0,0 +1,132 @@
+package mediacleaner
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const testPlaces = "2988507\tParis\tParis\tLutece,Paris\t48.85341\t2.3488\tP\tPPLC\tFR\t\t11\t75\t751\t75056\t2138551\t\t42\tEurope/Paris\t2023-01-01\n" +
+	"2643743\tLondon\tLondon\t\t51.50853\t-0.12574\tP\tPPLC\tGB\t\tENG\tGLA\t\t\t8961989\t\t25\tEurope/London\t2023-01-01\n" +
+	"3448439\tSão Paulo\tSao Paulo\t\t-23.5475\t-46.63611\tP\tPPLA\tBR\t\t27\t3550308\t\t\t10021295\t\t769\tAmerica/Sao_Paulo\t2023-01-01\n"
+
+func TestLoadPlaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"cities", testPlaces, 3, false},
+		{"short line", "2988507\tParis\tParis\n", 0, true},
+		{"bad latitude", "2988507\tParis\tParis\t\tnorth\t2.3488\tP\tPPLC\tFR\n", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := LoadPlaces(strings.NewReader(test.input))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Wanted error got nil")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if test.want != len(got) {
+				t.Errorf("Wanted %d places got %d", test.want, len(got))
+			}
+		})
+	}
+}
+
+func TestNearest(t *testing.T) {
+	places, _ := LoadPlaces(strings.NewReader(testPlaces))
+	tests := []struct {
+		name        string
+		lat         float64
+		lon         float64
+		maxDistance float64
+		want        string
+		wantFound   bool
+	}{
+		{"eiffel tower", 48.8584, 2.2945, 50, "Paris", true},
+		{"greenwich", 51.4769, 0.0005, 0, "London", true},
+		{"ascii name", -23.55, -46.63, 50, "Sao Paulo", true},
+		{"middle of the atlantic", 30, -40, 50, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, found := places.Nearest(test.lat, test.lon, test.maxDistance)
+			if test.wantFound != found {
+				t.Errorf("Wanted found to be %v", test.wantFound)
+			} else if found && test.want != got.Name {
+				t.Errorf("Wanted %q got %q", test.want, got.Name)
+			}
+		})
+	}
+}
+
+func TestDefaultPlaces(t *testing.T) {
+	tests := []struct {
+		name string
+		lat  float64
+		lon  float64
+		want string
+	}{
+		{"eiffel tower", 48.8584, 2.2945, "Paris"},
+		{"statue of liberty", 40.6892, -74.0445, "New York City"},
+		{"sydney opera house", -33.8568, 151.2153, "Sydney"},
+		{"shibuya", 35.6595, 139.7005, "Tokyo"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, found := DefaultPlaces.Nearest(test.lat, test.lon, 50)
+			if !found {
+				t.Errorf("Wanted a place near %v,%v", test.lat, test.lon)
+			} else if test.want != got.Name {
+				t.Errorf("Wanted %q got %q", test.want, got.Name)
+			}
+		})
+	}
+
+	for _, p := range DefaultPlaces {
+		if p.Name == "" || len(p.Country) != 2 || math.Abs(p.Latitude) > 90 || math.Abs(p.Longitude) > 180 {
+			t.Errorf("Invalid place %+v", p)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// Paris to London is roughly 344km
+	got := Distance(48.85341, 2.3488, 51.50853, -0.12574)
+	if math.Abs(got-344) > 2 {
+		t.Errorf("Wanted about 344km got %v", got)
+	}
+}
+
+func TestParseGPSPosition(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantLat float64
+		wantLon float64
+		wantErr error
+	}{
+		{`48 deg 51' 24.00" N, 2 deg 21' 7.20" E`, 48.8567, 2.352, nil},
+		{`23 deg 32' 51.00" S, 46 deg 38' 10.00" W`, -23.5475, -46.6361, nil},
+		{`-23.5475, -46.63611`, -23.5475, -46.6361, nil},
+		{`48 deg 51' 24.00" N`, 0, 0, ErrNoGPS},
+		{`somewhere, nowhere`, 0, 0, ErrNoGPS},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			lat, lon, err := ParseGPSPosition(test.input)
+			if test.wantErr != err {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if math.Abs(test.wantLat-lat) > 0.0001 || math.Abs(test.wantLon-lon) > 0.0001 {
+				t.Errorf("Wanted %v,%v got %v,%v", test.wantLat, test.wantLon, lat, lon)
+			}
+		})
+	}
+}
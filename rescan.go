@@ -0,0 +1,69 @@
+package mediacleaner
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+type handledFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// handledFiles records the files under a root that have been given to the
+// file callback, so that rescans only pick up files that were missed.
+// Files are forgotten once they are moved away or removed so that the
+// record doesn't grow for as long as the root is watched
+type handledFiles struct {
+	mu    sync.Mutex
+	files map[string]handledFile
+}
+
+func newHandledFiles() *handledFiles {
+	return &handledFiles{files: make(map[string]handledFile)}
+}
+
+// track wraps the callback so that every file it is called for is recorded
+func (hf *handledFiles) track(cb ContextFileCallback) ContextFileCallback {
+	return func(fs vfs.FileSystem, filename string, root string) ContextJob {
+		if info, err := fs.Stat(filename); err == nil {
+			hf.mu.Lock()
+			hf.files[filename] = handledFile{size: info.Size(), modTime: info.ModTime()}
+			hf.mu.Unlock()
+		}
+		return cb(fs, filename, root)
+	}
+}
+
+// handled determines if the file was handled before and hasn't changed since
+func (hf *handledFiles) handled(filename string, info os.FileInfo) bool {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	file, found := hf.files[filename]
+	return found && file.size == info.Size() && file.modTime.Equal(info.ModTime())
+}
+
+// forget removes the file from the record, it was moved away or removed
+func (hf *handledFiles) forget(filename string) {
+	hf.mu.Lock()
+	delete(hf.files, filename)
+	hf.mu.Unlock()
+}
+
+// prune forgets the files that a rescan didn't see and that no longer
+// exist.  Files that weren't seen because they were handled after the
+// rescan walked past their directory are kept
+func (hf *handledFiles) prune(fs vfs.FileSystem, seen map[string]bool) {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	for filename := range hf.files {
+		if seen[filename] {
+			continue
+		} else if _, err := fs.Stat(filename); os.IsNotExist(err) {
+			delete(hf.files, filename)
+		}
+	}
+}
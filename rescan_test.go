@@ -0,0 +1,148 @@
+package mediacleaner
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+func TestWatchRescan(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		event    *vfs.Event
+	}{
+		{"interval", 50 * time.Millisecond, nil},
+		{"overflow", 0, &vfs.Event{Type: vfs.ErrorEvent, Error: errors.New("fsnotify queue overflow")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oldSettle, oldInterval := SettleFlag, RescanIntervalFlag
+			SettleFlag, RescanIntervalFlag = 0, test.interval
+			defer func() { SettleFlag, RescanIntervalFlag = oldSettle, oldInterval }()
+
+			builder := &strings.Builder{}
+			oldLogger := Logger
+			Logger = log.New(builder, "", 0)
+			defer func() { Logger = oldLogger }()
+
+			tempdir, _ := ioutil.TempDir("", "osfs_test")
+			defer os.RemoveAll(tempdir)
+			fs := vfs.NewOsFs(tempdir)
+
+			queued := make(chan string, 16)
+			cb := func(fs vfs.FileSystem, filename string, root string) ContextJob {
+				queued <- filename
+				return nil
+			}
+
+			// a file processed by the initial scan
+			ioutil.WriteFile(filepath.Join(tempdir, "scanned.jpg"), nil, 0640)
+			handled := newHandledFiles()
+			handled.track(cb)(fs, "/scanned.jpg", tempdir)
+			<-queued
+
+			// a file whose event was missed
+			os.MkdirAll(filepath.Join(tempdir, "sub"), 0750)
+			ioutil.WriteFile(filepath.Join(tempdir, "sub/missed.jpg"), nil, 0640)
+
+			events := make(chan vfs.Event, 1)
+			done := make(chan bool)
+			go func() {
+				watch(fs, tempdir, nil, events, nil, cb, handled)
+				done <- true
+			}()
+
+			if test.event != nil {
+				events <- *test.event
+			}
+
+			select {
+			case got := <-queued:
+				if got != "/sub/missed.jpg" {
+					t.Errorf("Wanted /sub/missed.jpg got %q", got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for the rescan")
+			}
+
+			if test.event != nil {
+				events <- *test.event
+			}
+
+			// nothing is processed twice
+			select {
+			case got := <-queued:
+				t.Errorf("%q was processed again", got)
+			case <-time.After(150 * time.Millisecond):
+			}
+			close(events)
+			<-done
+		})
+	}
+}
+
+func TestHandledFilesForget(t *testing.T) {
+	tests := []struct {
+		name      string
+		seen      []string
+		remove    []string
+		event     *vfs.Event
+		wantFiles []string
+	}{
+		{"unseen file exists", []string{"/kept.jpg", "/removed.jpg"}, nil, nil, []string{"/kept.jpg", "/removed.jpg", "/unseen.jpg"}},
+		{"removed", []string{"/kept.jpg"}, []string{"/removed.jpg"}, nil, []string{"/kept.jpg", "/unseen.jpg"}},
+		{"remove event", nil, []string{"/removed.jpg"}, &vfs.Event{Type: vfs.RemoveEvent, Path: "/removed.jpg"}, []string{"/kept.jpg", "/unseen.jpg"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir, _ := ioutil.TempDir("", "osfs_test")
+			defer os.RemoveAll(tempdir)
+			fs := vfs.NewOsFs(tempdir)
+
+			handled := newHandledFiles()
+			cb := func(fs vfs.FileSystem, filename string, root string) ContextJob { return nil }
+			for _, filename := range []string{"/kept.jpg", "/removed.jpg", "/unseen.jpg"} {
+				ioutil.WriteFile(filepath.Join(tempdir, filename), nil, 0640)
+				handled.track(cb)(fs, filename, tempdir)
+			}
+
+			for _, filename := range test.remove {
+				os.Remove(filepath.Join(tempdir, filename))
+			}
+
+			if test.event != nil {
+				events := make(chan vfs.Event, 1)
+				events <- *test.event
+				close(events)
+				watch(fs, tempdir, nil, events, nil, cb, handled)
+			} else {
+				seen := make(map[string]bool)
+				for _, filename := range test.seen {
+					seen[filename] = true
+				}
+				handled.prune(fs, seen)
+			}
+
+			got := []string{}
+			for filename := range handled.files {
+				got = append(got, filename)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(test.wantFiles, got) {
+				t.Errorf("Wanted %v got %v", test.wantFiles, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package mediacleaner
+
+import (
+	"os"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+type settlingFile struct {
+	size    int64
+	modTime time.Time
+
+	// since is when the file was last seen changing
+	since time.Time
+}
+
+// settler tracks newly created files until they stop changing.  A file has
+// settled once its size and modification time have been the same for the
+// settle period, at which point it is safe to process
+type settler struct {
+	period time.Duration
+	files  map[string]*settlingFile
+	now    func() time.Time
+}
+
+func newSettler(period time.Duration) *settler {
+	return &settler{period: period, files: make(map[string]*settlingFile), now: time.Now}
+}
+
+// add starts tracking the file
+func (s *settler) add(filename string, info os.FileInfo) {
+	s.files[filename] = &settlingFile{size: info.Size(), modTime: info.ModTime(), since: s.now()}
+}
+
+// touch restarts the settle period of a file that is being tracked
+func (s *settler) touch(filename string) {
+	if file, found := s.files[filename]; found {
+		file.since = s.now()
+	}
+}
+
+// remove stops tracking the file
+func (s *settler) remove(filename string) {
+	delete(s.files, filename)
+}
+
+// settled returns the files that have settled, they are no longer tracked.
+// Files that have disappeared are dropped
+func (s *settler) settled(fs vfs.FileSystem) map[string]os.FileInfo {
+	settled := make(map[string]os.FileInfo)
+	now := s.now()
+	for filename, file := range s.files {
+		info, err := fs.Stat(filename)
+		if err != nil {
+			delete(s.files, filename)
+		} else if info.Size() != file.size || !info.ModTime().Equal(file.modTime) {
+			file.size, file.modTime, file.since = info.Size(), info.ModTime(), now
+		} else if now.Sub(file.since) >= s.period {
+			delete(s.files, filename)
+			settled[filename] = info
+		}
+	}
+	return settled
+}
@@ -0,0 +1,118 @@
+package mediacleaner
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+func TestSettler(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+	vfs.WriteFile(fs, "/growing.jpg", []byte("foo"), 0640)
+	vfs.WriteFile(fs, "/done.jpg", []byte("foo"), 0640)
+	vfs.WriteFile(fs, "/removed.jpg", []byte("foo"), 0640)
+	vfs.WriteFile(fs, "/touched.jpg", []byte("foo"), 0640)
+
+	now := time.Date(2019, 7, 14, 10, 0, 0, 0, time.UTC)
+	s := newSettler(time.Second)
+	s.now = func() time.Time { return now }
+	for _, filename := range []string{"/growing.jpg", "/done.jpg", "/removed.jpg", "/touched.jpg"} {
+		info, _ := fs.Stat(filename)
+		s.add(filename, info)
+	}
+
+	tests := []struct {
+		name   string
+		after  time.Duration
+		change func()
+		want   []string
+	}{
+		{"too soon", 500 * time.Millisecond, func() {}, []string{}},
+		{"changes", 500 * time.Millisecond, func() {
+			vfs.WriteFile(fs, "/growing.jpg", []byte("foobar"), 0640)
+			fs.Remove("/removed.jpg")
+			s.touch("/touched.jpg")
+		}, []string{"/done.jpg"}},
+		{"settled", time.Second, func() {}, []string{"/growing.jpg", "/touched.jpg"}},
+		{"nothing left", time.Second, func() {}, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now = now.Add(test.after)
+			test.change()
+			got := []string{}
+			for filename := range s.settled(fs) {
+				got = append(got, filename)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestWatchSettle(t *testing.T) {
+	oldSettle := SettleFlag
+	SettleFlag = 200 * time.Millisecond
+	defer func() { SettleFlag = oldSettle }()
+
+	builder := &strings.Builder{}
+	oldLogger := Logger
+	Logger = log.New(builder, "", 0)
+	defer func() { Logger = oldLogger }()
+
+	tempdir, _ := ioutil.TempDir("", "osfs_test")
+	defer os.RemoveAll(tempdir)
+	fs := vfs.NewOsFs(tempdir)
+
+	queued := make(chan string, 2)
+	events := make(chan vfs.Event)
+	done := make(chan bool)
+	go func() {
+		watch(fs, tempdir, nil, events, nil, func(fs vfs.FileSystem, filename string, root string) ContextJob {
+			queued <- filename
+			return nil
+		}, nil)
+		done <- true
+	}()
+
+	filename := filepath.Join(tempdir, "upload.mp4")
+	ioutil.WriteFile(filename, []byte("partial"), 0640)
+	events <- vfs.Event{Type: vfs.CreateEvent, Path: "/upload.mp4"}
+
+	// keep writing for longer than the settle period
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		file, _ := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0640)
+		file.Write([]byte("more"))
+		file.Close()
+		events <- vfs.Event{Type: vfs.ModifyEvent, Path: "/upload.mp4"}
+		select {
+		case got := <-queued:
+			t.Fatalf("%q was queued while it was still being written", got)
+		default:
+		}
+	}
+
+	select {
+	case got := <-queued:
+		if got != "/upload.mp4" {
+			t.Errorf("Wanted /upload.mp4 got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Timed out waiting for the file to settle")
+	}
+	close(events)
+	<-done
+}
@@ -0,0 +1,114 @@
+package mediacleaner
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// ExitIncomplete is the exit code used when the process was
+	// shut down before all of the work was done
+	ExitIncomplete = 3
+)
+
+var (
+	errStopped = errors.New("shutting down")
+
+	// AbortTimeout is how long a second signal waits for cancelled
+	// jobs to clean up before exiting
+	AbortTimeout = 10 * time.Second
+
+	// exit is replaced in tests
+	exit = os.Exit
+)
+
+// Stopped determines if the process is shutting down
+func (p *Process) Stopped() bool {
+	select {
+	case <-p.stopCh:
+		return true
+	default:
+	}
+	return false
+}
+
+// incomplete records that some work was not done
+func (p *Process) incomplete() {
+	atomic.StoreInt32(&p.remaining, 1)
+}
+
+// Shutdown stops the process from accepting new jobs.  Scans stop, watchers
+// are closed and jobs that haven't started are dropped.  Jobs that are
+// already running are allowed to finish
+func (p *Process) Shutdown() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+		go p.Kill()
+	})
+}
+
+// abort cancels the context given to the running jobs and waits up to
+// AbortTimeout for them to clean up
+func (p *Process) abort() {
+	p.runningMu.Lock()
+	running := []chan struct{}{}
+	for job, done := range p.running {
+		Infof("Cancelling %s", job.Name())
+		running = append(running, done)
+	}
+	p.runningMu.Unlock()
+	p.cancel()
+
+	timeout := time.After(AbortTimeout)
+	for _, done := range running {
+		select {
+		case <-done:
+		case <-timeout:
+			Errorf("Timed out waiting for cancelled jobs")
+			return
+		}
+	}
+}
+
+// ExitCode returns the code the command should exit with once the process
+// has finished.  It is ExitIncomplete if the process was shut down before
+// all of the work was done, and zero otherwise
+func (p *Process) ExitCode() int {
+	if atomic.LoadInt32(&p.remaining) != 0 {
+		return ExitIncomplete
+	}
+	return 0
+}
+
+// handleSignals shuts the process down on the first SIGINT or SIGTERM.  A
+// second signal cancels the running jobs and exits immediately
+func (p *Process) handleSignals(signals <-chan os.Signal) {
+	sig, ok := <-signals
+	if !ok {
+		return
+	}
+	Infof("Received %v, finishing running jobs. Send it again to abort", sig)
+	p.Shutdown()
+
+	sig, ok = <-signals
+	if !ok {
+		return
+	}
+	Infof("Received %v, aborting", sig)
+	p.abort()
+	code := ExitIncomplete
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+	exit(code)
+}
+
+func notifySignals(p *Process) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go p.handleSignals(signals)
+}
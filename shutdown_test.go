@@ -0,0 +1,194 @@
+package mediacleaner
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// cancelJob runs until its context is cancelled
+type cancelJob struct {
+	testJob
+	started chan<- bool
+}
+
+func (cj *cancelJob) Execute(ctx context.Context) error {
+	cj.started <- true
+	<-ctx.Done()
+	return cj.testJob.Execute(ctx)
+}
+
+func TestShutdown(t *testing.T) {
+	oldLogger := Logger
+	Logger = log.New(ioutil.Discard, "", 0)
+	defer func() { Logger = oldLogger }()
+
+	started := make(chan bool)
+	release := make(chan bool)
+	running := &blockingJob{testJob: testJob{name: "running"}, started: started, release: release}
+	queued := &testJob{name: "queued"}
+
+	p := newProcess()
+	queue := make(chan ContextJob)
+	done := make(chan bool)
+	go func() {
+		p.process(queue)
+		done <- true
+	}()
+
+	queue <- running
+	<-started
+	p.Shutdown()
+	p.Shutdown()
+	queue <- queued
+	close(release)
+	close(queue)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the process to finish")
+	}
+
+	if !running.execute {
+		t.Errorf("Wanted the running job to finish")
+	}
+
+	if queued.check || queued.execute {
+		t.Errorf("Wanted the queued job to be dropped")
+	}
+
+	if p.ExitCode() != ExitIncomplete {
+		t.Errorf("Wanted exit code %d got %d", ExitIncomplete, p.ExitCode())
+	}
+}
+
+// idleJob waits without its worker slot until its context is done
+type idleJob struct {
+	testJob
+	started chan<- bool
+}
+
+func (ij *idleJob) Execute(ctx context.Context) error {
+	err := Idle(ctx, func(ctx context.Context) error {
+		ij.started <- true
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err == nil {
+		err = ij.testJob.Execute(ctx)
+	}
+	return err
+}
+
+func TestIdle(t *testing.T) {
+	oldLogger := Logger
+	Logger = log.New(ioutil.Discard, "", 0)
+	defer func() { Logger = oldLogger }()
+
+	oldConcurrency := Concurrency
+	Concurrency = 1
+	defer func() { Concurrency = oldConcurrency }()
+
+	started := make(chan bool)
+	idle := &idleJob{testJob: testJob{name: "idle"}, started: started}
+	otherStarted := make(chan bool)
+	release := make(chan bool)
+	close(release)
+	other := &blockingJob{testJob: testJob{name: "other"}, started: otherStarted, release: release}
+
+	p := newProcess()
+	queue := make(chan ContextJob)
+	done := make(chan bool)
+	go func() {
+		p.process(queue)
+		done <- true
+	}()
+
+	queue <- idle
+	<-started
+
+	// the idle job doesn't hold the only worker slot
+	queue <- other
+	close(queue)
+	select {
+	case <-otherStarted:
+	case <-time.After(time.Second):
+		t.Fatalf("Wanted other jobs to run while the job is idle")
+	}
+
+	// the idle job stops waiting when the process shuts down
+	p.Shutdown()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the process to finish")
+	}
+
+	if idle.execute {
+		t.Errorf("Wanted the idle job to give up")
+	}
+
+	if p.ExitCode() != ExitIncomplete {
+		t.Errorf("Wanted exit code %d got %d", ExitIncomplete, p.ExitCode())
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	queue := make(chan ContextJob, 1)
+	queue <- &testJob{name: "foo"}
+	close(queue)
+
+	p := newProcess()
+	p.process(queue)
+	if p.ExitCode() != 0 {
+		t.Errorf("Wanted exit code 0 got %d", p.ExitCode())
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	oldLogger := Logger
+	Logger = log.New(ioutil.Discard, "", 0)
+	defer func() { Logger = oldLogger }()
+
+	exitCode := make(chan int, 1)
+	oldExit := exit
+	exit = func(code int) { exitCode <- code }
+	defer func() { exit = oldExit }()
+
+	started := make(chan bool)
+	jb := &cancelJob{testJob: testJob{name: "foo"}, started: started}
+	p := newProcess()
+	queue := make(chan ContextJob)
+	go p.process(queue)
+	queue <- jb
+	<-started
+
+	signals := make(chan os.Signal)
+	go p.handleSignals(signals)
+
+	signals <- os.Interrupt
+	signals <- syscall.SIGTERM
+	if !p.Stopped() {
+		t.Errorf("Wanted the process to be stopped after the first signal")
+	}
+
+	select {
+	case code := <-exitCode:
+		if code != 128+int(syscall.SIGTERM) {
+			t.Errorf("Wanted exit code %d got %d", 128+int(syscall.SIGTERM), code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for exit")
+	}
+
+	if !jb.execute {
+		t.Errorf("Wanted the cancelled job to have returned before exiting")
+	}
+	close(queue)
+}
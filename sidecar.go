@@ -0,0 +1,48 @@
+package mediacleaner
+
+import (
+	"path"
+	"strings"
+
+	"github.com/mh-orange/vfs"
+)
+
+// SidecarExts are the extensions of files that hold extra information
+// about a media file, rather than media themselves.  These include XMP
+// metadata, iOS edits (AAE), camera thumbnails (THM) and subtitles or
+// telemetry (SRT)
+var SidecarExts = map[string]bool{".xmp": true, ".aae": true, ".thm": true, ".srt": true}
+
+// IsSidecar determines if the file is a sidecar file
+func IsSidecar(filename string) bool {
+	return SidecarExts[strings.ToLower(path.Ext(filename))]
+}
+
+// Sidecars returns the sidecar files that belong to the media file.  A sidecar
+// either shares the media file's stem (DSC_0001.xmp) or has the sidecar extension
+// appended to the full filename (DSC_0001.NEF.xmp).  Sidecar files have no
+// sidecars of their own
+func Sidecars(fs vfs.FileSystem, filename string) ([]string, error) {
+	sidecars := []string{}
+	if IsSidecar(filename) {
+		return sidecars, nil
+	}
+
+	companions, err := Companions(fs, filename)
+	for _, companion := range companions {
+		if IsSidecar(companion) {
+			sidecars = append(sidecars, companion)
+		}
+	}
+
+	if err == nil {
+		var entries []string
+		entries, err = vfs.Glob(fs, filename+".*")
+		for _, entry := range entries {
+			if IsSidecar(entry) && Stem(entry) == path.Base(filename) {
+				sidecars = append(sidecars, entry)
+			}
+		}
+	}
+	return sidecars, err
+}
@@ -0,0 +1,44 @@
+package mediacleaner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+)
+
+func TestSidecars(t *testing.T) {
+	fs := vfs.NewMemFs()
+	defer fs.Close()
+	for _, filename := range []string{"/DSC_0001.NEF", "/DSC_0001.xmp", "/DSC_0001.NEF.xmp", "/DSC_0001.jpg", "/IMG_1234.HEIC", "/IMG_1234.AAE", "/GOPR0001.MP4", "/GOPR0001.THM", "/GOPR0001.SRT"} {
+		fs.Create(filename)
+	}
+
+	tests := []struct {
+		input       string
+		want        []string
+		wantSidecar bool
+	}{
+		{"/DSC_0001.NEF", []string{"/DSC_0001.xmp", "/DSC_0001.NEF.xmp"}, false},
+		{"/IMG_1234.HEIC", []string{"/IMG_1234.AAE"}, false},
+		{"/GOPR0001.MP4", []string{"/GOPR0001.SRT", "/GOPR0001.THM"}, false},
+		{"/GOPR0001.THM", []string{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := Sidecars(fs, test.input)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted sidecars %v got %v", test.want, got)
+			}
+
+			if test.wantSidecar != IsSidecar(test.input) {
+				t.Errorf("Wanted IsSidecar to be %v", test.wantSidecar)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package mediacleaner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a daily period of time (such as 01:00-06:00) during which
+// work is allowed to run.  A window whose end is before its start wraps
+// around midnight.  The zero value is a window that is always open.  TimeWindow
+// satisfies the flag.Value interface so it can be set from the command line
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func parseClock(str string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(str))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", str)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+// Set parses a window in the form HH:MM-HH:MM
+func (tw *TimeWindow) Set(str string) (err error) {
+	tokens := strings.Split(str, "-")
+	if len(tokens) != 2 {
+		return fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", str)
+	}
+
+	tw.Start, err = parseClock(tokens[0])
+	if err == nil {
+		tw.End, err = parseClock(tokens[1])
+	}
+	return err
+}
+
+func (tw *TimeWindow) String() string {
+	if tw == nil || tw.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", int(tw.Start.Hours()), int(tw.Start.Minutes())%60, int(tw.End.Hours()), int(tw.End.Minutes())%60)
+}
+
+// IsZero indicates whether the window is always open
+func (tw *TimeWindow) IsZero() bool {
+	return tw.Start == tw.End
+}
+
+// Contains determines if the time of day of t falls within the window
+func (tw *TimeWindow) Contains(t time.Time) bool {
+	if tw.IsZero() {
+		return true
+	}
+
+	now := sinceMidnight(t)
+	if tw.Start < tw.End {
+		return tw.Start <= now && now < tw.End
+	}
+	return tw.Start <= now || now < tw.End
+}
+
+// Until returns the amount of time from t until the window next opens.  If
+// t is within the window then Until returns 0
+func (tw *TimeWindow) Until(t time.Time) time.Duration {
+	if tw.Contains(t) {
+		return 0
+	}
+
+	wait := tw.Start - sinceMidnight(t)
+	if wait < 0 {
+		wait += 24 * time.Hour
+	}
+	return wait
+}
+
+// Wait blocks until the window is open
+func (tw *TimeWindow) Wait() {
+	tw.WaitContext(context.Background())
+}
+
+// WaitContext blocks until the window is open or the context is done.  The
+// context's error is returned if it is done, even when the window is open
+func (tw *TimeWindow) WaitContext(ctx context.Context) error {
+	if wait := tw.Until(time.Now()); wait > 0 {
+		Infof("Waiting %v for the %v window to open", wait.Round(time.Second), tw)
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,95 @@
+package mediacleaner
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestTimeWindowSet(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    TimeWindow
+		wantErr bool
+	}{
+		{"01:00-06:00", TimeWindow{Start: time.Hour, End: 6 * time.Hour}, false},
+		{"22:30-05:15", TimeWindow{Start: 22*time.Hour + 30*time.Minute, End: 5*time.Hour + 15*time.Minute}, false},
+		{"01:00", TimeWindow{}, true},
+		{"1am-6am", TimeWindow{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got := TimeWindow{}
+			gotErr := got.Set(test.input)
+			if test.wantErr {
+				if gotErr == nil {
+					t.Errorf("Wanted error got nil")
+				}
+			} else if gotErr != nil {
+				t.Errorf("Unexpected error: %v", gotErr)
+			} else {
+				if test.want != got {
+					t.Errorf("Wanted %v got %v", test.want, got)
+				}
+
+				if test.input != got.String() {
+					t.Errorf("Wanted string %q got %q", test.input, got.String())
+				}
+			}
+		})
+	}
+}
+
+func TestTimeWindowUntil(t *testing.T) {
+	at := func(hour, min int) time.Time { return time.Date(2019, 7, 14, hour, min, 0, 0, time.Local) }
+	tests := []struct {
+		name   string
+		window string
+		input  time.Time
+		want   time.Duration
+	}{
+		{"always open", "", at(12, 0), 0},
+		{"inside", "01:00-06:00", at(3, 0), 0},
+		{"before", "01:00-06:00", at(0, 30), 30 * time.Minute},
+		{"after", "01:00-06:00", at(6, 0), 19 * time.Hour},
+		{"wrapped inside late", "22:00-06:00", at(23, 0), 0},
+		{"wrapped inside early", "22:00-06:00", at(5, 0), 0},
+		{"wrapped outside", "22:00-06:00", at(12, 0), 10 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window := TimeWindow{}
+			if test.window != "" {
+				window.Set(test.window)
+			}
+			got := window.Until(test.input)
+			if test.want != got {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTimeWindowWaitContext(t *testing.T) {
+	oldLogger := Logger
+	Logger = log.New(ioutil.Discard, "", 0)
+	defer func() { Logger = oldLogger }()
+
+	// a window that opens in an hour
+	start := (sinceMidnight(time.Now()) + time.Hour) % (24 * time.Hour)
+	window := TimeWindow{Start: start, End: (start + time.Hour) % (24 * time.Hour)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := window.WaitContext(ctx); err != context.Canceled {
+		t.Errorf("Wanted %v got %v", context.Canceled, err)
+	}
+
+	if err := (&TimeWindow{}).WaitContext(context.Background()); err != nil {
+		t.Errorf("Wanted an open window not to wait, got %v", err)
+	}
+}